@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"gas/helpers"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+/*
+Profiles are named Cloudflare credentials kept in the user's
+config dir rather than in projects:
+
+	{
+	  "current": "work",
+	  "profiles": {
+	    "work": { "accountId": "...", "apiToken": "..." }
+	  }
+	}
+
+The file is only readable by the user (0600).
+*/
+type Store struct {
+	path     string
+	Current  string              `json:"current,omitempty"`
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+type Profile struct {
+	AccountID string `json:"accountId"`
+	APIToken  string `json:"apiToken"`
+}
+
+func filePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find user config dir\n%v", err)
+	}
+	return filepath.Join(configDir, "gas", "profiles.json"), nil
+}
+
+func Load() (*Store, error) {
+	path, err := filePath()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		path:     path,
+		Profiles: make(map[string]*Profile),
+	}
+
+	if !helpers.IsFilePresent(path) {
+		return s, nil
+	}
+
+	err = helpers.UnmarshallFile(path, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Profiles == nil {
+		s.Profiles = make(map[string]*Profile)
+	}
+
+	return s, nil
+}
+
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		return fmt.Errorf("unable to create profiles dir\n%v", err)
+	}
+
+	err = os.WriteFile(s.path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to write profiles file %s\n%v", s.path, err)
+	}
+
+	// WriteFile doesn't change the mode of an existing file.
+	err = os.Chmod(s.path, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to set mode of profiles file %s\n%v", s.path, err)
+	}
+
+	return nil
+}
+
+/*
+The first profile that's set becomes the current profile.
+*/
+func (s *Store) Set(name string, profile *Profile) {
+	s.Profiles[name] = profile
+	if s.Current == "" {
+		s.Current = name
+	}
+}
+
+func (s *Store) Get(name string) (*Profile, error) {
+	profile, ok := s.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %s doesn't exist (see gas auth list)", name)
+	}
+	return profile, nil
+}
+
+func (s *Store) Use(name string) error {
+	_, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	s.Current = name
+	return nil
+}
+
+func (s *Store) Remove(name string) error {
+	_, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	delete(s.Profiles, name)
+	if s.Current == name {
+		s.Current = ""
+	}
+	return nil
+}
+
+func (s *Store) Names() []string {
+	result := make([]string, 0, len(s.Profiles))
+	for name := range s.Profiles {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"gas/auth"
+	"gas/resources"
+	"os"
+	"sort"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/spf13/cobra"
+)
+
+var (
+	authAccountID string
+	profile       string
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage Cloudflare credential profiles",
+	Long: `Manage named Cloudflare credential profiles.
+
+Profiles are kept in the user's config dir. The current
+profile (or the one selected with --profile) provides
+CLOUDFLARE_ACCOUNT_ID and CLOUDFLARE_API_TOKEN unless they're
+already set in the environment or a .env file.`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login PROFILE",
+	Short: "Add or replace a profile",
+	Long: `Add or replace a profile. The API token is read from stdin,
+or prompted for if stdin is a terminal, and verified with
+Cloudflare before it's saved.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		token, err := readSecretValue("API token")
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		accountID, err := verifyCloudflareAPIToken(token, authAccountID)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		store, err := auth.Load()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		store.Set(name, &auth.Profile{
+			AccountID: accountID,
+			APIToken:  token,
+		})
+
+		err = store.Save()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Saved profile %s (account %s)\n", name, accountID)
+	},
+}
+
+var authListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List profiles",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := auth.Load()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		names := store.Names()
+		if len(names) == 0 {
+			fmt.Println("No profiles (see gas auth login)")
+			return
+		}
+
+		for _, name := range names {
+			marker := " "
+			if name == store.Current {
+				marker = "*"
+			}
+			fmt.Printf("%s %s (account %s)\n", marker, name, store.Profiles[name].AccountID)
+		}
+	},
+}
+
+var authUseCmd = &cobra.Command{
+	Use:   "use PROFILE",
+	Short: "Set the current profile",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := auth.Load()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		err = store.Use(args[0])
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		err = store.Save()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Using profile %s\n", args[0])
+	},
+}
+
+var authRequiredPermissionsCmd = &cobra.Command{
+	Use:   "required-permissions",
+	Short: "Print the permissions a token needs to deploy the project",
+	Long: `Print the least-privilege API token permissions needed to
+deploy every resource in the project, by account. Use it to
+create a CI token.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		r := resources.New()
+
+		// The token is usually created before the first deploy,
+		// when there's no up .json file yet.
+		err := r.InitWithOptionalUp()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		accountToPermissions := r.RequiredPermissions()
+
+		accounts := make([]string, 0, len(accountToPermissions))
+		for account := range accountToPermissions {
+			accounts = append(accounts, account)
+		}
+		sort.Strings(accounts)
+
+		for _, account := range accounts {
+			if account == "" {
+				fmt.Println("Account default:")
+			} else {
+				fmt.Printf("Account %s:\n", account)
+			}
+			for _, permission := range accountToPermissions[account] {
+				fmt.Printf("  %s\n", permission)
+			}
+		}
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout PROFILE",
+	Short: "Remove a profile",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := auth.Load()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		err = store.Remove(args[0])
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		err = store.Save()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Removed profile %s\n", args[0])
+	},
+}
+
+func init() {
+	authLoginCmd.Flags().StringVar(&authAccountID, "account-id", "", "account ID (default is the token's account if it only has one)")
+
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authListCmd)
+	authCmd.AddCommand(authUseCmd)
+	authCmd.AddCommand(authLogoutCmd)
+	authCmd.AddCommand(authRequiredPermissionsCmd)
+}
+
+/*
+Returns the account ID to save with the token. If one isn't
+given, the token's only account is used.
+*/
+func verifyCloudflareAPIToken(token string, accountID string) (string, error) {
+	api, err := cloudflare.NewWithAPIToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := api.VerifyAPIToken(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("unable to verify API token\n%v", err)
+	}
+	if res.Status != "active" {
+		return "", fmt.Errorf("API token is %s", res.Status)
+	}
+
+	if accountID != "" {
+		return accountID, nil
+	}
+
+	accounts, _, err := api.Accounts(context.Background(), cloudflare.AccountsListParams{})
+	if err != nil {
+		return "", fmt.Errorf("unable to list accounts of API token\n%v", err)
+	}
+	if len(accounts) != 1 {
+		return "", fmt.Errorf("API token has access to %d accounts, set one with --account-id", len(accounts))
+	}
+
+	return accounts[0].ID, nil
+}
+
+/*
+Env vars (including ones from a .env file) take precedence
+over the profile, so CI and one-off overrides keep working.
+*/
+func applyAuthProfile() error {
+	store, err := auth.Load()
+	if err != nil {
+		return err
+	}
+
+	name := profile
+	if name == "" {
+		name = store.Current
+	}
+	if name == "" {
+		return nil
+	}
+
+	p, err := store.Get(name)
+	if err != nil {
+		return err
+	}
+
+	if os.Getenv("CLOUDFLARE_ACCOUNT_ID") == "" {
+		os.Setenv("CLOUDFLARE_ACCOUNT_ID", p.AccountID)
+	}
+	if os.Getenv("CLOUDFLARE_API_TOKEN") == "" {
+		os.Setenv("CLOUDFLARE_API_TOKEN", p.APIToken)
+	}
+
+	return nil
+}
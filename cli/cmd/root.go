@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/cobra"
@@ -39,6 +38,7 @@ Use "{{.CommandPath}} [command] --help" for more information about a command.{{e
 
 var (
 	configFile string
+	stage      string
 	rootCmd    = &cobra.Command{
 		Use:   "gas",
 		Short: "gas is a CLI tool for managing your project",
@@ -50,6 +50,13 @@ Custom Help:
     CLOUDFLARE_ACCOUNT_ID  Your Cloudflare account ID
     CLOUDFLARE_API_TOKEN   Your Cloudflare API token
 
+    They can also come from a profile (see gas auth), but env
+    vars and .env files take precedence.
+
+    Resources in named accounts read their credentials from the
+    env vars set for the account in gas.config.json. Only the
+    accounts a deploy touches need credentials.
+
   Configuration:
     A config file named gas.config.json is required in the project root.`,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -73,18 +80,26 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 
+	rootCmd.PersistentPreRunE = readProjectConfig
+
 	rootCmd.SetHelpTemplate(customHelpTemplate)
 
 	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "config file (default is ./gas.config.json)")
+	rootCmd.PersistentFlags().StringVar(&stage, "stage", "dev", "stage to use (e.g. for secrets and vars)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "credential profile to use (default is the current profile, see gas auth)")
 
 	rootCmd.AddCommand(addCmd)
+	rootCmd.AddCommand(authCmd)
 	rootCmd.AddCommand(createCmd)
+	rootCmd.AddCommand(schemaCmd)
+	rootCmd.AddCommand(secretsCmd)
 	rootCmd.AddCommand(upCmd)
 }
 
 func initConfig() {
 	viper.SetDefault("resourceContainerDirPath", "gas")
 	viper.SetDefault("upJsonPath", "gas.up.json")
+	viper.SetDefault("secretsJsonPath", "gas.secrets.json")
 
 	if configFile != "" {
 		viper.SetConfigFile(configFile)
@@ -93,43 +108,68 @@ func initConfig() {
 		viper.SetConfigType("json")
 		viper.AddConfigPath(".")
 	}
+}
 
-	// Check if there are any arguments and if the first one is not "create"
-	if len(os.Args) > 1 && os.Args[1] != "create" {
-		err := viper.ReadInConfig()
-		if err != nil {
-			fmt.Printf("Error: unable to read config file\n%s\n", err)
-			os.Exit(1)
-		}
+/*
+The project config is read once the command to run is known,
+so flags before the command (e.g. gas --profile ci create)
+don't change whether it's read.
+*/
+func readProjectConfig(cmd *cobra.Command, args []string) error {
+	if !isProjectCommand(cmd) {
+		return nil
+	}
 
-		godotenv.Load()
+	// Errors from here on aren't usage errors.
+	cmd.SilenceUsage = true
 
-		viper.AutomaticEnv()
+	err := viper.ReadInConfig()
+	if err != nil {
+		return fmt.Errorf("unable to read config file\n%s", err)
+	}
 
-		project := viper.GetString("project")
-		if project == "" {
-			fmt.Printf("Error: 'project' property is required in config file '%s'\n", viper.ConfigFileUsed())
-			os.Exit(1)
-		}
+	godotenv.Load()
 
-		requiredEnvVars := []string{"CLOUDFLARE_ACCOUNT_ID", "CLOUDFLARE_API_TOKEN"}
-		err = ValidateRequiredEnvVars(requiredEnvVars)
-		if err != nil {
-			fmt.Println("Error:", err)
-			os.Exit(1)
-		}
+	err = applyAuthProfile()
+	if err != nil {
+		return err
 	}
+
+	viper.AutomaticEnv()
+
+	viper.Set("stage", stage)
+
+	project := viper.GetString("project")
+	if project == "" {
+		return fmt.Errorf("'project' property is required in config file '%s'", viper.ConfigFileUsed())
+	}
+
+	return nil
 }
 
-func ValidateRequiredEnvVars(keys []string) error {
-	var missingVars []string
-	for _, key := range keys {
-		if viper.GetString(key) == "" {
-			missingVars = append(missingVars, key)
-		}
+/*
+Profiles live in the user's config dir, so auth commands
+don't need a project, apart from required-permissions which
+reads the project's resources. Schemas don't depend on a
+project either, and neither do help and shell completions.
+*/
+func isProjectCommand(cmd *cobra.Command) bool {
+	switch cmd {
+	case authRequiredPermissionsCmd:
+		return true
+	case createCmd, schemaCmd:
+		return false
 	}
-	if len(missingVars) > 0 {
-		return fmt.Errorf("the following required environment variables are not set -> %s", strings.Join(missingVars, ", "))
+
+	for c := cmd; c != nil; c = c.Parent() {
+		if c == authCmd {
+			return false
+		}
+		switch c.Name() {
+		case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+			return false
+		}
 	}
-	return nil
+
+	return true
 }
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestIsProjectCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected bool
+	}{
+		{args: []string{}, expected: true},
+		{args: []string{"up"}, expected: true},
+		{args: []string{"--stage", "prod", "up"}, expected: true},
+		{args: []string{"secrets", "set", "CORE_BASE_API", "KEY"}, expected: true},
+		{args: []string{"create"}, expected: false},
+		{args: []string{"--profile", "ci", "create"}, expected: false},
+		{args: []string{"--config", "gas.config.json", "schema", "--out", "schemas"}, expected: false},
+		{args: []string{"auth", "login"}, expected: false},
+		{args: []string{"--profile", "ci", "auth", "list"}, expected: false},
+		{args: []string{"auth", "required-permissions"}, expected: true},
+		{args: []string{"--profile", "ci", "auth", "required-permissions"}, expected: true},
+		{args: []string{"help", "up"}, expected: false},
+	}
+
+	rootCmd.InitDefaultHelpCmd()
+
+	for _, tt := range tests {
+		cmd, _, err := rootCmd.Find(tt.args)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if result := isProjectCommand(cmd); result != tt.expected {
+			t.Errorf("%v: got %v, expected %v", tt.args, result, tt.expected)
+		}
+	}
+}
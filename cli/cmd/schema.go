@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"gas/resources"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var schemaOutDir string
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Write JSON Schemas for gas.config.json and resource configs",
+	Long: `Write JSON Schema files for gas.config.json and for the
+config of every resource type. They're derived from the same
+definitions gas validates configs against, so editors can
+complete configs and CI can check them without running gas.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		paths, err := resources.WriteSchemas(schemaOutDir)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		for _, path := range paths {
+			fmt.Printf("Wrote %s\n", path)
+		}
+	},
+}
+
+func init() {
+	schemaCmd.Flags().StringVar(&schemaOutDir, "out", resources.DefaultSchemasDir, "dir to write schemas to")
+}
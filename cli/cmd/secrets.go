@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+	"gas/resources"
+	"gas/secrets"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var secretsFromEnv string
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage worker secrets",
+	Long: `Manage worker secrets per stage.
+
+Secret values are encrypted in gas.secrets.json or read from
+an env var on deploy. Only hashes of values are stored in the
+up .json file. Values are never printed.`,
+}
+
+var secretsSetCmd = &cobra.Command{
+	Use:   "set RESOURCE KEY",
+	Short: "Set a secret",
+	Long: `Set a secret. The value is read from stdin, or prompted for
+if stdin is a terminal. Use --from-env to read the value from
+an env var on deploy instead.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		resource, key := args[0], args[1]
+
+		err := validateSecretsResource(resource)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		store, err := secrets.Load()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		stage := viper.GetString("stage")
+
+		if secretsFromEnv != "" {
+			store.SetFromEnv(stage, resource, key, secretsFromEnv)
+		} else {
+			value, err := readSecretValue(key)
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+
+			err = store.Set(stage, resource, key, value)
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}
+
+		err = store.Save()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Set secret %s of %s in stage %s\n", key, resource, stage)
+	},
+}
+
+var secretsListCmd = &cobra.Command{
+	Use:   "list RESOURCE",
+	Short: "List a resource's secrets",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := secrets.Load()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		stage := viper.GetString("stage")
+
+		list := store.List(stage, args[0])
+		if len(list) == 0 {
+			fmt.Printf("No secrets for %s in stage %s\n", args[0], stage)
+			return
+		}
+
+		for _, secret := range list {
+			if secret.Env != "" {
+				fmt.Printf("%s (from env %s)\n", secret.Key, secret.Env)
+				continue
+			}
+			fmt.Println(secret.Key)
+		}
+	},
+}
+
+var secretsRmCmd = &cobra.Command{
+	Use:   "rm RESOURCE KEY",
+	Short: "Remove a secret",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		resource, key := args[0], args[1]
+
+		store, err := secrets.Load()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		stage := viper.GetString("stage")
+
+		err = store.Remove(stage, resource, key)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		err = store.Save()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Removed secret %s of %s in stage %s\n", key, resource, stage)
+	},
+}
+
+func init() {
+	secretsSetCmd.Flags().StringVar(&secretsFromEnv, "from-env", "", "env var to read the value from on deploy")
+
+	secretsCmd.AddCommand(secretsSetCmd)
+	secretsCmd.AddCommand(secretsListCmd)
+	secretsCmd.AddCommand(secretsRmCmd)
+}
+
+/*
+Resources are named by their configs, so configs are
+evaluated to check the resource exists.
+*/
+func validateSecretsResource(resource string) error {
+	r := resources.New()
+
+	err := r.Init()
+	if err != nil {
+		return err
+	}
+
+	if !r.HasName(resource) {
+		return fmt.Errorf("resource %s doesn't exist", resource)
+	}
+
+	return nil
+}
+
+func readSecretValue(key string) (string, error) {
+	if term.IsTerminal(os.Stdin.Fd()) {
+		fmt.Printf("Value of %s: ", key)
+		value, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Println()
+		if err != nil {
+			return "", fmt.Errorf("unable to read secret value\n%v", err)
+		}
+		return string(value), nil
+	}
+
+	value, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret value\n%v", err)
+	}
+	return strings.TrimRight(string(value), "\r\n"), nil
+}
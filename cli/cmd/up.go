@@ -21,11 +21,19 @@ var upCmd = &cobra.Command{
 		}
 
 		if r.HasNamesToDeploy() {
+			err = r.Preflight()
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+
 			err = r.Deploy()
 			if err != nil {
 				fmt.Println("Error:", err)
 				os.Exit(1)
 			}
+
+			os.Exit(0)
 		}
 
 		fmt.Println("No resource changes to deploy")
@@ -1,6 +1,9 @@
 package graph
 
-import "gas/helpers"
+import (
+	"gas/helpers"
+	"sort"
+)
 
 type Graph struct {
 	nodeToDeps               NodeToDeps
@@ -218,3 +221,90 @@ func (g *Graph) setGroupToDepthToNodes() {
 		g.GroupToDepthToNodes[group][depth] = append(g.GroupToDepthToNodes[group][depth], node)
 	}
 }
+
+/*
+Cycles are groups of nodes that depend on each other,
+directly or through other nodes in the group. For example,
+given a graph of A->B, B->C, C->A, and C->D, A, B, and C are
+a cycle.
+
+New can't be used with a graph that has cycles, so they
+have to be found and broken first.
+*/
+func Cycles(nodeToDeps NodeToDeps) [][]string {
+	t := &tarjan{
+		nodeToDeps: nodeToDeps,
+		index:      make(map[string]int),
+		lowLink:    make(map[string]int),
+		onStack:    make(map[string]bool),
+		result:     make([][]string, 0),
+	}
+
+	nodes := make([]string, 0, len(nodeToDeps))
+	for node := range nodeToDeps {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	for _, node := range nodes {
+		if _, ok := t.index[node]; !ok {
+			t.strongConnect(node)
+		}
+	}
+
+	return t.result
+}
+
+/*
+Cycles are found with Tarjan's strongly connected
+components algorithm.
+*/
+type tarjan struct {
+	nodeToDeps NodeToDeps
+	counter    int
+	index      map[string]int
+	lowLink    map[string]int
+	stack      []string
+	onStack    map[string]bool
+	result     [][]string
+}
+
+func (t *tarjan) strongConnect(node string) {
+	t.index[node] = t.counter
+	t.lowLink[node] = t.counter
+	t.counter++
+	t.stack = append(t.stack, node)
+	t.onStack[node] = true
+
+	for _, dep := range t.nodeToDeps[node] {
+		if _, ok := t.index[dep]; !ok {
+			t.strongConnect(dep)
+			t.lowLink[node] = min(t.lowLink[node], t.lowLink[dep])
+		} else if t.onStack[dep] {
+			t.lowLink[node] = min(t.lowLink[node], t.index[dep])
+		}
+	}
+
+	if t.lowLink[node] != t.index[node] {
+		return
+	}
+
+	component := make([]string, 0)
+	for {
+		last := t.stack[len(t.stack)-1]
+		t.stack = t.stack[:len(t.stack)-1]
+		t.onStack[last] = false
+		component = append(component, last)
+		if last == node {
+			break
+		}
+	}
+
+	// A single node is only a cycle if it depends on itself.
+	if len(component) == 1 && !helpers.IsStringInSlice(t.nodeToDeps[node], node) {
+		return
+	}
+
+	sort.Strings(component)
+	t.result = append(t.result, component)
+}
@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCycles(t *testing.T) {
+	tests := []struct {
+		name       string
+		nodeToDeps NodeToDeps
+		expected   [][]string
+	}{
+		{
+			name:       "no nodes",
+			nodeToDeps: NodeToDeps{},
+			expected:   [][]string{},
+		},
+		{
+			name: "no cycles",
+			nodeToDeps: NodeToDeps{
+				"A": {"B"},
+				"B": {"C"},
+				"C": {},
+				"X": {"C"},
+			},
+			expected: [][]string{},
+		},
+		{
+			name: "two node cycle",
+			nodeToDeps: NodeToDeps{
+				"A": {"B"},
+				"B": {"A"},
+			},
+			expected: [][]string{{"A", "B"}},
+		},
+		{
+			name: "cycle through other nodes with a dep outside it",
+			nodeToDeps: NodeToDeps{
+				"A": {"B"},
+				"B": {"C"},
+				"C": {"A", "D"},
+				"D": {},
+			},
+			expected: [][]string{{"A", "B", "C"}},
+		},
+		{
+			name: "node that depends on itself",
+			nodeToDeps: NodeToDeps{
+				"A": {"A"},
+				"B": {"A"},
+			},
+			expected: [][]string{{"A"}},
+		},
+		{
+			name: "separate cycles",
+			nodeToDeps: NodeToDeps{
+				"A": {"B"},
+				"B": {"A"},
+				"C": {"D"},
+				"D": {"C", "A"},
+			},
+			expected: [][]string{{"A", "B"}, {"C", "D"}},
+		},
+		{
+			name: "dep without an entry",
+			nodeToDeps: NodeToDeps{
+				"A": {"B"},
+			},
+			expected: [][]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Cycles(tt.nodeToDeps)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("got %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
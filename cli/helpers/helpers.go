@@ -22,6 +22,13 @@ func CapitalSnakeCaseToTrainCase(s string) string {
 	return strings.Join(words, "-")
 }
 
+/*
+CORE_BASE_API -> core-base-api
+*/
+func CapitalSnakeCaseToKebabCase(s string) string {
+	return strings.ToLower(strings.ReplaceAll(s, "_", "-"))
+}
+
 func CheckIfDirExists(path string) (bool, error) {
 	info, err := os.Stat(path)
 	if os.IsNotExist(err) {
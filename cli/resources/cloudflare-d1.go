@@ -0,0 +1,311 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gas/helpers"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+const (
+	CLOUDFLARE_D1_CREATED processorKeyType = "cloudflare-d1:CREATED"
+	CLOUDFLARE_D1_DELETED processorKeyType = "cloudflare-d1:DELETED"
+	CLOUDFLARE_D1_UPDATED processorKeyType = "cloudflare-d1:UPDATED"
+)
+
+type CloudflareD1Config struct {
+	ConfigCommon
+	LocationHint  string `json:"locationHint,omitempty" schema:"enum=wnam|enam|weur|eeur|apac|oc"`
+	MigrationsDir string `json:"migrationsDir,omitempty"`
+}
+
+/*
+Applied migrations are the file names of the migrations that
+have been applied to the database, in the order they were
+applied.
+*/
+type CloudflareD1Output struct {
+	ID                string   `json:"id"`
+	AppliedMigrations []string `json:"appliedMigrations"`
+}
+
+func init() {
+	registerConfig("cloudflare-d1", func(config config) interface{} {
+		return decodeConfig(config, &CloudflareD1Config{})
+	})
+
+	registerUpOutput("cloudflare-d1", func(output upOutput) interface{} {
+		return decodeUpOutput(output, &CloudflareD1Output{})
+	})
+
+	registerDeployOutput(CLOUDFLARE_D1_CREATED, func(res interface{}) interface{} {
+		return res.(*CloudflareD1Output)
+	})
+
+	registerDeployOutput(CLOUDFLARE_D1_UPDATED, func(res interface{}) interface{} {
+		return res.(*CloudflareD1Output)
+	})
+
+	// D1 databases can't be renamed or moved.
+	registerReplaceFields("cloudflare-d1", "name", "locationHint")
+
+	registerReplaceWarning("cloudflare-d1", "the database's data will be lost")
+
+	registerPendingChanges("cloudflare-d1", func(dir string, config interface{}, upOutput interface{}) ([]string, error) {
+		migrationsDirPath := cloudflareD1MigrationsDirPath(dir, config.(*CloudflareD1Config))
+		migrations, err := readCloudflareD1MigrationFileNames(migrationsDirPath, upOutput.(*CloudflareD1Output))
+		if err != nil {
+			return nil, err
+		}
+		result := make([]string, 0, len(migrations))
+		for _, migration := range migrations {
+			result = append(result, "migration "+migration)
+		}
+		return result, nil
+	})
+
+	registerPermissions("cloudflare-d1", func(config interface{}, state stateType) []string {
+		return []string{"D1 Write"}
+	})
+
+	registerProcessor(CLOUDFLARE_D1_CREATED, processCloudflareD1Created)
+	registerProcessor(CLOUDFLARE_D1_DELETED, processCloudflareD1Deleted)
+	registerProcessor(CLOUDFLARE_D1_UPDATED, processCloudflareD1Updated)
+
+	registerCloudflareWorkerBindings(setCloudflareWorkerD1Bindings)
+	registerConfigRefs("cloudflare-worker", cloudflareWorkerD1Refs)
+}
+
+/*
+Database names include the location hint, if there is one, so
+a replacement database in another location can be created
+before the database it replaces is deleted.
+
+CORE_DB, weur -> project-core-db-weur
+*/
+func newCloudflareD1DatabaseName(c *CloudflareD1Config) string {
+	if c.LocationHint == "" {
+		return cloudflareResourceName(c.Name)
+	}
+	return cloudflareResourceName(c.Name) + "-" + c.LocationHint
+}
+
+const cloudflareD1DefaultMigrationsDir = "migrations"
+
+func cloudflareD1MigrationsDirPath(dir string, c *CloudflareD1Config) string {
+	if c.MigrationsDir != "" {
+		return filepath.Join(dir, c.MigrationsDir)
+	}
+	return filepath.Join(dir, cloudflareD1DefaultMigrationsDir)
+}
+
+/*
+Migrations are .sql files in the migrations dir. They're
+applied in file name order, so they should be prefixed with
+a sequence number (e.g. 0001_create_users.sql). Migrations
+already in the output are skipped.
+*/
+func readCloudflareD1MigrationFileNames(migrationsDirPath string, output *CloudflareD1Output) ([]string, error) {
+	result := make([]string, 0)
+
+	entries, err := os.ReadDir(migrationsDirPath)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read migrations dir %s\n%v", migrationsDirPath, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		if output != nil && helpers.IsStringInSlice(output.AppliedMigrations, entry.Name()) {
+			continue
+		}
+		result = append(result, entry.Name())
+	}
+
+	sort.Strings(result)
+
+	return result, nil
+}
+
+/*
+Migrations are applied one at a time, and the output is
+updated after each one. If a migration fails, the output
+still records the migrations applied before it so they
+aren't applied again on the next deploy.
+*/
+func applyCloudflareD1Migrations(api *cloudflareClient, p *processorParams, key processorKeyType, output *CloudflareD1Output) error {
+	c := p.config.(*CloudflareD1Config)
+
+	migrationsDirPath := cloudflareD1MigrationsDirPath(p.dir, c)
+
+	migrations, err := readCloudflareD1MigrationFileNames(migrationsDirPath, output)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		sql, err := helpers.ReadFile(filepath.Join(migrationsDirPath, migration))
+		if err != nil {
+			return err
+		}
+
+		_, err = api.QueryD1Database(context.Background(), api.account, cloudflare.QueryD1DatabaseParams{
+			DatabaseID: output.ID,
+			SQL:        string(sql),
+		})
+		if err != nil {
+			return fmt.Errorf("unable to apply migration %s\n%v", migration, err)
+		}
+
+		output.AppliedMigrations = append(output.AppliedMigrations, migration)
+
+		p.deployOutput.set(p.name, key, output)
+	}
+
+	return nil
+}
+
+/*
+D1 bindings are named after the D1 resource they bind to,
+like KV bindings (see cloudflareKvNamespaceID).
+*/
+func cloudflareWorkerD1Refs(config interface{}) []string {
+	result := make([]string, 0)
+	for _, d1 := range config.(*CloudflareWorkerConfig).D1 {
+		result = append(result, d1.Binding)
+	}
+	return result
+}
+
+func setCloudflareWorkerD1Bindings(p *processorParams, c *CloudflareWorkerConfig, bindings cloudflareWorkerBindings) error {
+	for _, d1 := range c.D1 {
+		output, err := p.depOutputByConfigName("cloudflare-d1", d1.Binding)
+		if err != nil {
+			return err
+		}
+		bindings[d1.Binding] = cloudflare.WorkerD1DatabaseBinding{
+			DatabaseID: output.(*CloudflareD1Output).ID,
+		}
+	}
+	return nil
+}
+
+func processCloudflareD1Created(p *processorParams) {
+	c := p.config.(*CloudflareD1Config)
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	// The SDK's create params don't support location hints.
+	res, err := api.Raw(
+		context.Background(),
+		http.MethodPost,
+		fmt.Sprintf("/accounts/%s/d1/database", api.account.Identifier),
+		map[string]interface{}{
+			"name":                  newCloudflareD1DatabaseName(c),
+			"primary_location_hint": c.LocationHint,
+		},
+		nil,
+	)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	var database cloudflare.D1Database
+	err = json.Unmarshal(res.Result, &database)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	output := &CloudflareD1Output{
+		ID:                database.UUID,
+		AppliedMigrations: make([]string, 0),
+	}
+
+	p.deployOutput.set(p.name, CLOUDFLARE_D1_CREATED, output)
+
+	err = applyCloudflareD1Migrations(api, p, CLOUDFLARE_D1_CREATED, output)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.processOkChan <- true
+}
+
+func processCloudflareD1Updated(p *processorParams) {
+	uo, ok := p.upOutput.(*CloudflareD1Output)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	output := &CloudflareD1Output{
+		ID:                uo.ID,
+		AppliedMigrations: append(make([]string, 0), uo.AppliedMigrations...),
+	}
+
+	err = applyCloudflareD1Migrations(api, p, CLOUDFLARE_D1_UPDATED, output)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.deployOutput.set(p.name, CLOUDFLARE_D1_UPDATED, output)
+
+	p.processOkChan <- true
+}
+
+func processCloudflareD1Deleted(p *processorParams) {
+	uo, ok := p.upOutput.(*CloudflareD1Output)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	err = api.DeleteD1Database(context.Background(), api.account, uo.ID)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.processOkChan <- true
+}
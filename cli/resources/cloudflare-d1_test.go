@@ -0,0 +1,120 @@
+package resources
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadCloudflareD1MigrationFileNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []string
+		output   *CloudflareD1Output
+		expected []string
+	}{
+		{
+			name:     "applied in file name order",
+			files:    []string{"0010_add_index.sql", "0002_add_posts.sql", "0001_create_users.sql"},
+			expected: []string{"0001_create_users.sql", "0002_add_posts.sql", "0010_add_index.sql"},
+		},
+		{
+			name:     "applied migrations skipped",
+			files:    []string{"0001_create_users.sql", "0002_add_posts.sql", "0003_add_index.sql"},
+			output:   &CloudflareD1Output{ID: "db-id", AppliedMigrations: []string{"0001_create_users.sql", "0002_add_posts.sql"}},
+			expected: []string{"0003_add_index.sql"},
+		},
+		{
+			name:     "non-sql files and dirs skipped",
+			files:    []string{"0001_create_users.sql", "README.md", "archive/0000_old.sql"},
+			expected: []string{"0001_create_users.sql"},
+		},
+		{
+			name:     "every migration applied",
+			files:    []string{"0001_create_users.sql"},
+			output:   &CloudflareD1Output{ID: "db-id", AppliedMigrations: []string{"0001_create_users.sql"}},
+			expected: []string{},
+		},
+		{
+			name:     "missing migrations dir",
+			files:    nil,
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrationsDirPath := filepath.Join(t.TempDir(), "migrations")
+			for _, file := range tt.files {
+				path := filepath.Join(migrationsDirPath, file)
+				err := os.MkdirAll(filepath.Dir(path), 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(path, []byte("SELECT 1;"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := readCloudflareD1MigrationFileNames(migrationsDirPath, tt.output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("got %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+/*
+A deployed database is only UPDATED when a migration is added,
+and the plan lists the migrations that will be applied.
+*/
+func TestAddedCloudflareD1MigrationIsPending(t *testing.T) {
+	dir := t.TempDir()
+	writeMigration := func(name string) {
+		t.Helper()
+		err := os.MkdirAll(filepath.Join(dir, "migrations"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, "migrations", name), []byte("SELECT 1;"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exports := map[string][]*exportedConfig{
+		dir: {
+			{ExportName: "coreBaseDb", Config: config{"type": "cloudflare-d1", "name": "CORE_BASE_DB"}},
+		},
+	}
+	upJsonPath := newTestUpJsonPath(t, "{}")
+
+	writeMigration("0001_create_users.sql")
+	deployTestResources(t, newTestResources(t, upJsonPath, exports), map[string]interface{}{
+		"CORE_BASE_DB": &CloudflareD1Output{ID: "db-id", AppliedMigrations: []string{"0001_create_users.sql"}},
+	})
+
+	r := newTestResources(t, upJsonPath, exports)
+	if state := r.nameToState["CORE_BASE_DB"]; state != stateType(UNCHANGED) {
+		t.Fatalf("got %s with every migration applied, expected UNCHANGED", state)
+	}
+
+	writeMigration("0002_add_posts.sql")
+	r = newTestResources(t, upJsonPath, exports)
+	if state := r.nameToState["CORE_BASE_DB"]; state != stateType(UPDATED) {
+		t.Fatalf("got %s with a new migration, expected UPDATED", state)
+	}
+	if r.shouldReplace("CORE_BASE_DB") {
+		t.Error("expected the database to be updated in place")
+	}
+
+	expected := []string{"migration 0002_add_posts.sql"}
+	if !reflect.DeepEqual(r.nameToPendingChanges["CORE_BASE_DB"], expected) {
+		t.Errorf("got pending changes %v, expected %v", r.nameToPendingChanges["CORE_BASE_DB"], expected)
+	}
+}
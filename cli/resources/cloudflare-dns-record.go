@@ -0,0 +1,201 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"gas/helpers"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+const (
+	CLOUDFLARE_DNS_RECORD_CREATED processorKeyType = "cloudflare-dns-record:CREATED"
+	CLOUDFLARE_DNS_RECORD_DELETED processorKeyType = "cloudflare-dns-record:DELETED"
+	CLOUDFLARE_DNS_RECORD_UPDATED processorKeyType = "cloudflare-dns-record:UPDATED"
+)
+
+var cloudflareDnsRecordTypes = []string{"A", "AAAA", "CNAME", "TXT", "MX"}
+
+/*
+Zone is the config name of the cloudflare-dns-zone resource
+the record belongs to. The record resource has to depend on
+that zone resource.
+*/
+type CloudflareDnsRecordConfig struct {
+	ConfigCommon
+	Zone       string  `json:"zone"`
+	RecordType string  `json:"recordType" schema:"enum=A|AAAA|CNAME|TXT|MX"`
+	RecordName string  `json:"recordName"`
+	Content    string  `json:"content"`
+	TTL        int     `json:"ttl,omitempty"`
+	Proxied    *bool   `json:"proxied,omitempty"`
+	Priority   *uint16 `json:"priority,omitempty"`
+}
+
+type CloudflareDnsRecordOutput struct {
+	ID     string `json:"id"`
+	ZoneID string `json:"zoneId"`
+}
+
+func init() {
+	registerConfig("cloudflare-dns-record", func(config config) interface{} {
+		return decodeConfig(config, &CloudflareDnsRecordConfig{})
+	})
+
+	registerUpOutput("cloudflare-dns-record", func(output upOutput) interface{} {
+		return decodeUpOutput(output, &CloudflareDnsRecordOutput{})
+	})
+
+	registerDeployOutput(CLOUDFLARE_DNS_RECORD_CREATED, func(res interface{}) interface{} {
+		r := res.(cloudflare.DNSRecord)
+
+		return &CloudflareDnsRecordOutput{
+			ID:     r.ID,
+			ZoneID: r.ZoneID,
+		}
+	})
+
+	// Records can't be moved between zones.
+	registerReplaceFields("cloudflare-dns-record", "zone")
+
+	registerConfigRefs("cloudflare-dns-record", func(config interface{}) []string {
+		return []string{config.(*CloudflareDnsRecordConfig).Zone}
+	})
+
+	registerPermissions("cloudflare-dns-record", func(config interface{}, state stateType) []string {
+		return []string{"DNS Write"}
+	})
+
+	registerProcessor(CLOUDFLARE_DNS_RECORD_CREATED, processCloudflareDnsRecordCreated)
+	registerProcessor(CLOUDFLARE_DNS_RECORD_DELETED, processCloudflareDnsRecordDeleted)
+	registerProcessor(CLOUDFLARE_DNS_RECORD_UPDATED, processCloudflareDnsRecordUpdated)
+}
+
+func validateCloudflareDnsRecordType(c *CloudflareDnsRecordConfig) error {
+	if !helpers.IsStringInSlice(cloudflareDnsRecordTypes, c.RecordType) {
+		return fmt.Errorf("unsupported DNS record type %s for %s", c.RecordType, c.Name)
+	}
+	return nil
+}
+
+/*
+Cloudflare treats a TTL of 1 as automatic.
+*/
+func cloudflareDnsRecordTTL(c *CloudflareDnsRecordConfig) int {
+	if c.TTL == 0 {
+		return 1
+	}
+	return c.TTL
+}
+
+func processCloudflareDnsRecordCreated(p *processorParams) {
+	c := p.config.(*CloudflareDnsRecordConfig)
+
+	err := validateCloudflareDnsRecordType(c)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	zoneID, err := cloudflareDnsZoneID(p, c.Zone)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	res, err := api.CreateDNSRecord(context.Background(), cloudflare.ZoneIdentifier(zoneID), cloudflare.CreateDNSRecordParams{
+		Type:     c.RecordType,
+		Name:     c.RecordName,
+		Content:  c.Content,
+		TTL:      cloudflareDnsRecordTTL(c),
+		Proxied:  c.Proxied,
+		Priority: c.Priority,
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	// Not every response includes the zone ID.
+	res.ZoneID = zoneID
+
+	p.deployOutput.set(p.name, CLOUDFLARE_DNS_RECORD_CREATED, res)
+
+	p.processOkChan <- true
+}
+
+func processCloudflareDnsRecordUpdated(p *processorParams) {
+	c := p.config.(*CloudflareDnsRecordConfig)
+	uo, ok := p.upOutput.(*CloudflareDnsRecordOutput)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	err := validateCloudflareDnsRecordType(c)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	_, err = api.UpdateDNSRecord(context.Background(), cloudflare.ZoneIdentifier(uo.ZoneID), cloudflare.UpdateDNSRecordParams{
+		ID:       uo.ID,
+		Type:     c.RecordType,
+		Name:     c.RecordName,
+		Content:  c.Content,
+		TTL:      cloudflareDnsRecordTTL(c),
+		Proxied:  c.Proxied,
+		Priority: c.Priority,
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.processOkChan <- true
+}
+
+func processCloudflareDnsRecordDeleted(p *processorParams) {
+	uo, ok := p.upOutput.(*CloudflareDnsRecordOutput)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	err = api.DeleteDNSRecord(context.Background(), cloudflare.ZoneIdentifier(uo.ZoneID), uo.ID)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.processOkChan <- true
+}
@@ -0,0 +1,194 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+const (
+	CLOUDFLARE_DNS_ZONE_CREATED processorKeyType = "cloudflare-dns-zone:CREATED"
+	CLOUDFLARE_DNS_ZONE_DELETED processorKeyType = "cloudflare-dns-zone:DELETED"
+	CLOUDFLARE_DNS_ZONE_UPDATED processorKeyType = "cloudflare-dns-zone:UPDATED"
+)
+
+type CloudflareDnsZoneConfig struct {
+	ConfigCommon
+	Domain string `json:"domain"`
+	Paused bool   `json:"paused,omitempty"`
+}
+
+/*
+Adopted zones existed before gas managed them, so deleting
+the resource only stops gas from managing the zone.
+*/
+type CloudflareDnsZoneOutput struct {
+	ID          string   `json:"id"`
+	Domain      string   `json:"domain"`
+	NameServers []string `json:"nameServers"`
+	Adopted     bool     `json:"adopted"`
+}
+
+func init() {
+	registerConfig("cloudflare-dns-zone", func(config config) interface{} {
+		return decodeConfig(config, &CloudflareDnsZoneConfig{})
+	})
+
+	registerUpOutput("cloudflare-dns-zone", func(output upOutput) interface{} {
+		return decodeUpOutput(output, &CloudflareDnsZoneOutput{})
+	})
+
+	registerDeployOutput(CLOUDFLARE_DNS_ZONE_CREATED, func(res interface{}) interface{} {
+		return res.(*CloudflareDnsZoneOutput)
+	})
+
+	registerDeployOutput(CLOUDFLARE_DNS_ZONE_UPDATED, func(res interface{}) interface{} {
+		return res.(*CloudflareDnsZoneOutput)
+	})
+
+	registerReplaceFields("cloudflare-dns-zone", "domain")
+
+	registerPermissions("cloudflare-dns-zone", func(config interface{}, state stateType) []string {
+		return []string{"Zone Write"}
+	})
+
+	registerProcessor(CLOUDFLARE_DNS_ZONE_CREATED, processCloudflareDnsZoneCreated)
+	registerProcessor(CLOUDFLARE_DNS_ZONE_DELETED, processCloudflareDnsZoneDeleted)
+	registerProcessor(CLOUDFLARE_DNS_ZONE_UPDATED, processCloudflareDnsZoneUpdated)
+}
+
+/*
+A zone's dependents reference it by config name, so its ID
+is the output of the dep with that config name.
+*/
+func cloudflareDnsZoneID(p *processorParams, zone string) (string, error) {
+	output, err := p.depOutputByConfigName("cloudflare-dns-zone", zone)
+	if err != nil {
+		return "", err
+	}
+	return output.(*CloudflareDnsZoneOutput).ID, nil
+}
+
+/*
+An existing zone for the domain is adopted instead of
+created because a domain can only belong to one zone.
+*/
+func processCloudflareDnsZoneCreated(p *processorParams) {
+	c := p.config.(*CloudflareDnsZoneConfig)
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	zones, err := api.ListZones(context.Background(), c.Domain)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	var zone cloudflare.Zone
+	adopted := len(zones) > 0
+
+	if adopted {
+		zone = zones[0]
+	} else {
+		zone, err = api.CreateZone(
+			context.Background(),
+			c.Domain,
+			false,
+			cloudflare.Account{ID: api.account.Identifier},
+			"full",
+		)
+		if err != nil {
+			fmt.Println("Error:", err)
+			p.processOkChan <- false
+			return
+		}
+	}
+
+	if zone.Paused != c.Paused {
+		zone, err = api.ZoneSetPaused(context.Background(), zone.ID, c.Paused)
+		if err != nil {
+			fmt.Println("Error:", err)
+			p.processOkChan <- false
+			return
+		}
+	}
+
+	p.deployOutput.set(p.name, CLOUDFLARE_DNS_ZONE_CREATED, &CloudflareDnsZoneOutput{
+		ID:          zone.ID,
+		Domain:      zone.Name,
+		NameServers: zone.NameServers,
+		Adopted:     adopted,
+	})
+
+	p.processOkChan <- true
+}
+
+func processCloudflareDnsZoneUpdated(p *processorParams) {
+	c := p.config.(*CloudflareDnsZoneConfig)
+	uo, ok := p.upOutput.(*CloudflareDnsZoneOutput)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	zone, err := api.ZoneSetPaused(context.Background(), uo.ID, c.Paused)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.deployOutput.set(p.name, CLOUDFLARE_DNS_ZONE_UPDATED, &CloudflareDnsZoneOutput{
+		ID:          zone.ID,
+		Domain:      zone.Name,
+		NameServers: zone.NameServers,
+		Adopted:     uo.Adopted,
+	})
+
+	p.processOkChan <- true
+}
+
+func processCloudflareDnsZoneDeleted(p *processorParams) {
+	uo, ok := p.upOutput.(*CloudflareDnsZoneOutput)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	if uo.Adopted {
+		p.processOkChan <- true
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	_, err = api.DeleteZone(context.Background(), uo.ID)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.processOkChan <- true
+}
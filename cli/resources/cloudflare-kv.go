@@ -0,0 +1,155 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"gas/helpers"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/spf13/viper"
+)
+
+const (
+	CLOUDFLARE_KV_CREATED processorKeyType = "cloudflare-kv:CREATED"
+	CLOUDFLARE_KV_DELETED processorKeyType = "cloudflare-kv:DELETED"
+	CLOUDFLARE_KV_UPDATED processorKeyType = "cloudflare-kv:UPDATED"
+)
+
+type CloudflareKVConfig struct {
+	ConfigCommon
+}
+
+type CloudflareKVOutput struct {
+	ID string `json:"id"`
+}
+
+func init() {
+	registerConfig("cloudflare-kv", func(config config) interface{} {
+		return decodeConfig(config, &CloudflareKVConfig{})
+	})
+
+	registerUpOutput("cloudflare-kv", func(output upOutput) interface{} {
+		return decodeUpOutput(output, &CloudflareKVOutput{})
+	})
+
+	registerDeployOutput(CLOUDFLARE_KV_CREATED, func(res interface{}) interface{} {
+		r := res.(cloudflare.WorkersKVNamespaceResponse)
+
+		return &CloudflareKVOutput{
+			ID: r.Result.ID,
+		}
+	})
+
+	registerPermissions("cloudflare-kv", func(config interface{}, state stateType) []string {
+		return []string{"Workers KV Storage Write"}
+	})
+
+	registerProcessor(CLOUDFLARE_KV_CREATED, processCloudflareKvCreated)
+	registerProcessor(CLOUDFLARE_KV_DELETED, processCloudflareKvDeleted)
+	registerProcessor(CLOUDFLARE_KV_UPDATED, processCloudflareKvUpdated)
+}
+
+/*
+CORE_BASE_KV -> project-Core-Base-Kv
+*/
+func cloudflareKvTitle(name string) string {
+	return viper.GetString("project") + "-" + helpers.CapitalSnakeCaseToTrainCase(name)
+}
+
+/*
+A KV binding's name is the config name of the KV resource
+it binds to, so the namespace ID is the output of the dep
+with that config name.
+*/
+func cloudflareKvNamespaceID(p *processorParams, binding string) (string, error) {
+	output, err := p.depOutputByConfigName("cloudflare-kv", binding)
+	if err != nil {
+		return "", err
+	}
+	return output.(*CloudflareKVOutput).ID, nil
+}
+
+func processCloudflareKvCreated(p *processorParams) {
+	c := p.config.(*CloudflareKVConfig)
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	req := cloudflare.CreateWorkersKVNamespaceParams{Title: cloudflareKvTitle(c.Name)}
+
+	res, err := api.CreateWorkersKVNamespace(context.Background(), api.account, req)
+
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.deployOutput.set(p.name, CLOUDFLARE_KV_CREATED, res)
+
+	p.processOkChan <- true
+}
+
+func processCloudflareKvDeleted(p *processorParams) {
+	uo, ok := p.upOutput.(*CloudflareKVOutput)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	_, err = api.DeleteWorkersKVNamespace(context.Background(), api.account, uo.ID)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.processOkChan <- true
+}
+
+/*
+KV namespaces are identified by ID, so a name change is
+applied by renaming the namespace's title in place.
+*/
+func processCloudflareKvUpdated(p *processorParams) {
+	c := p.config.(*CloudflareKVConfig)
+	uo, ok := p.upOutput.(*CloudflareKVOutput)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	req := cloudflare.UpdateWorkersKVNamespaceParams{
+		NamespaceID: uo.ID,
+		Title:       cloudflareKvTitle(c.Name),
+	}
+
+	_, err = api.UpdateWorkersKVNamespace(context.Background(), api.account, req)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.processOkChan <- true
+}
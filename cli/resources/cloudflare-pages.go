@@ -0,0 +1,639 @@
+package resources
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+	"lukechampine.com/blake3"
+)
+
+const (
+	CLOUDFLARE_PAGES_CREATED processorKeyType = "cloudflare-pages:CREATED"
+	CLOUDFLARE_PAGES_DELETED processorKeyType = "cloudflare-pages:DELETED"
+	CLOUDFLARE_PAGES_UPDATED processorKeyType = "cloudflare-pages:UPDATED"
+)
+
+type CloudflarePagesConfig struct {
+	ConfigCommon
+	OutputDir        string `json:"outputDir,omitempty"`
+	ProductionBranch string `json:"productionBranch,omitempty"`
+	Services         []struct {
+		Binding string `json:"binding"`
+	} `json:"services,omitempty"`
+}
+
+type CloudflarePagesOutput struct {
+	ProjectName    string `json:"projectName"`
+	Subdomain      string `json:"subdomain"`
+	URL            string `json:"url"`
+	DeploymentHash string `json:"deploymentHash,omitempty"`
+}
+
+func init() {
+	registerConfig("cloudflare-pages", func(config config) interface{} {
+		return decodeConfig(config, &CloudflarePagesConfig{})
+	})
+
+	registerUpOutput("cloudflare-pages", func(output upOutput) interface{} {
+		return decodeUpOutput(output, &CloudflarePagesOutput{})
+	})
+
+	registerDeployOutput(CLOUDFLARE_PAGES_CREATED, func(res interface{}) interface{} {
+		return res.(*CloudflarePagesOutput)
+	})
+
+	registerDeployOutput(CLOUDFLARE_PAGES_UPDATED, func(res interface{}) interface{} {
+		return res.(*CloudflarePagesOutput)
+	})
+
+	// Project names are derived from config names and
+	// can't be changed once a project exists.
+	registerReplaceFields("cloudflare-pages", "name")
+
+	registerPendingChanges("cloudflare-pages", cloudflarePagesDeploymentChanges)
+
+	registerPermissions("cloudflare-pages", func(config interface{}, state stateType) []string {
+		return []string{"Pages Write"}
+	})
+
+	registerProcessor(CLOUDFLARE_PAGES_CREATED, processCloudflarePagesCreated)
+	registerProcessor(CLOUDFLARE_PAGES_DELETED, processCloudflarePagesDeleted)
+	registerProcessor(CLOUDFLARE_PAGES_UPDATED, processCloudflarePagesUpdated)
+}
+
+const cloudflarePagesDefaultOutputDir = "build"
+
+const cloudflarePagesDefaultProductionBranch = "main"
+
+/*
+Direct uploads are limited per request, so missing files
+are uploaded in batches.
+*/
+const (
+	cloudflarePagesMaxUploadBatchFiles = 100
+	cloudflarePagesMaxUploadBatchBytes = 40 * 1024 * 1024
+)
+
+func cloudflarePagesOutputDirPath(dir string, c *CloudflarePagesConfig) string {
+	if c.OutputDir != "" {
+		return filepath.Join(dir, c.OutputDir)
+	}
+	return filepath.Join(dir, cloudflarePagesDefaultOutputDir)
+}
+
+func cloudflarePagesProductionBranch(c *CloudflarePagesConfig) string {
+	if c.ProductionBranch != "" {
+		return c.ProductionBranch
+	}
+	return cloudflarePagesDefaultProductionBranch
+}
+
+func newCloudflarePagesServiceBindings(p *processorParams, c *CloudflarePagesConfig) (cloudflare.ServiceBindingMap, error) {
+	result := make(cloudflare.ServiceBindingMap)
+	for _, service := range c.Services {
+		scriptName, err := cloudflareWorkerScriptNameByConfigName(p, service.Binding)
+		if err != nil {
+			return nil, err
+		}
+		result[service.Binding] = &cloudflare.ServiceBinding{
+			Service:     scriptName,
+			Environment: "production",
+		}
+	}
+	return result, nil
+}
+
+type cloudflarePagesAsset struct {
+	path        string
+	hash        string
+	contentType string
+	content     []byte
+}
+
+/*
+Files Pages reads as project configuration rather than serving
+them are sent with the deployment instead of as assets.
+*/
+var cloudflarePagesDeploymentFiles = []string{"_worker.js", "_headers", "_redirects", "_routes.json"}
+
+var cloudflarePagesIgnoredNames = map[string]bool{
+	".DS_Store":    true,
+	".git":         true,
+	"functions":    true,
+	"node_modules": true,
+}
+
+/*
+Asset hashes have to match the ones wrangler computes so files
+already uploaded by either tool are never uploaded again.
+*/
+func hashCloudflarePagesAsset(path string, content []byte) string {
+	extension := strings.TrimPrefix(filepath.Ext(path), ".")
+	sum := blake3.Sum256([]byte(base64.StdEncoding.EncodeToString(content) + extension))
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+func readCloudflarePagesAssets(outputDirPath string) ([]*cloudflarePagesAsset, error) {
+	result := make([]*cloudflarePagesAsset, 0)
+
+	err := filepath.WalkDir(outputDirPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if cloudflarePagesIgnoredNames[entry.Name()] {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(outputDirPath, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		for _, deploymentFile := range cloudflarePagesDeploymentFiles {
+			if relPath == deploymentFile {
+				return nil
+			}
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to read file %s\n%v", path, err)
+		}
+
+		contentType := mime.TypeByExtension(filepath.Ext(path))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		result = append(result, &cloudflarePagesAsset{
+			path:        "/" + relPath,
+			hash:        hashCloudflarePagesAsset(path, content),
+			contentType: contentType,
+			content:     content,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to walk output dir %s\n%v", outputDirPath, err)
+	}
+
+	return result, nil
+}
+
+/*
+Asset requests are authorized with a short-lived project upload
+token rather than the account's API token.
+*/
+func newCloudflarePagesAssetsAPI(api *cloudflareClient, projectName string) (*cloudflare.API, error) {
+	res, err := api.Raw(
+		context.Background(),
+		http.MethodGet,
+		fmt.Sprintf("/accounts/%s/pages/projects/%s/upload-token", api.account.Identifier, projectName),
+		nil,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		JWT string `json:"jwt"`
+	}
+	err = json.Unmarshal(res.Result, &result)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse Pages upload token\n%v", err)
+	}
+
+	return cloudflare.NewWithAPIToken(result.JWT)
+}
+
+func checkMissingCloudflarePagesAssets(assetsAPI *cloudflare.API, assets []*cloudflarePagesAsset) (map[string]bool, error) {
+	hashes := make([]string, 0)
+	for _, asset := range assets {
+		hashes = append(hashes, asset.hash)
+	}
+
+	res, err := assetsAPI.Raw(context.Background(), http.MethodPost, "/pages/assets/check-missing", map[string]interface{}{
+		"hashes": hashes,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var missingHashes []string
+	err = json.Unmarshal(res.Result, &missingHashes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse Pages missing assets\n%v", err)
+	}
+
+	result := make(map[string]bool)
+	for _, hash := range missingHashes {
+		result[hash] = true
+	}
+	return result, nil
+}
+
+type cloudflarePagesUploadPayload struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Metadata struct {
+		ContentType string `json:"contentType"`
+	} `json:"metadata"`
+	Base64 bool `json:"base64"`
+}
+
+func uploadMissingCloudflarePagesAssets(assetsAPI *cloudflare.API, assets []*cloudflarePagesAsset) error {
+	missingHashes, err := checkMissingCloudflarePagesAssets(assetsAPI, assets)
+	if err != nil {
+		return err
+	}
+
+	batch := make([]cloudflarePagesUploadPayload, 0)
+	batchBytes := 0
+
+	uploadBatch := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := assetsAPI.Raw(context.Background(), http.MethodPost, "/pages/assets/upload", batch, nil)
+		batch = make([]cloudflarePagesUploadPayload, 0)
+		batchBytes = 0
+		return err
+	}
+
+	for _, asset := range assets {
+		if !missingHashes[asset.hash] {
+			continue
+		}
+
+		// Uploaded once even if multiple paths share the content.
+		delete(missingHashes, asset.hash)
+
+		payload := cloudflarePagesUploadPayload{
+			Key:    asset.hash,
+			Value:  base64.StdEncoding.EncodeToString(asset.content),
+			Base64: true,
+		}
+		payload.Metadata.ContentType = asset.contentType
+
+		if len(batch) == cloudflarePagesMaxUploadBatchFiles || batchBytes+len(payload.Value) > cloudflarePagesMaxUploadBatchBytes {
+			err := uploadBatch()
+			if err != nil {
+				return err
+			}
+		}
+
+		batch = append(batch, payload)
+		batchBytes += len(payload.Value)
+	}
+
+	err = uploadBatch()
+	if err != nil {
+		return err
+	}
+
+	hashes := make([]string, 0)
+	for _, asset := range assets {
+		hashes = append(hashes, asset.hash)
+	}
+
+	_, err = assetsAPI.Raw(context.Background(), http.MethodPost, "/pages/assets/upsert-hashes", map[string]interface{}{
+		"hashes": hashes,
+	}, nil)
+	return err
+}
+
+/*
+A project's files aren't part of its config, so the hash of
+what a deployment is made of (its manifest and deployment
+files) is kept in its output to tell when the files changed.
+*/
+func hashCloudflarePagesDeployment(outputDirPath string, assets []*cloudflarePagesAsset) (string, error) {
+	lines := make([]string, 0, len(assets)+len(cloudflarePagesDeploymentFiles))
+	for _, asset := range assets {
+		lines = append(lines, asset.path+" "+asset.hash)
+	}
+	sort.Strings(lines)
+
+	for _, deploymentFile := range cloudflarePagesDeploymentFiles {
+		content, err := os.ReadFile(filepath.Join(outputDirPath, deploymentFile))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("unable to read file %s\n%v", filepath.Join(outputDirPath, deploymentFile), err)
+		}
+		sum := sha256.Sum256(content)
+		lines = append(lines, deploymentFile+" "+hex.EncodeToString(sum[:]))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func cloudflarePagesDeploymentChanges(dir string, config interface{}, upOutput interface{}) ([]string, error) {
+	outputDirPath := cloudflarePagesOutputDirPath(dir, config.(*CloudflarePagesConfig))
+
+	assets, err := readCloudflarePagesAssets(outputDirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := hashCloudflarePagesDeployment(outputDirPath, assets)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash != upOutput.(*CloudflarePagesOutput).DeploymentHash {
+		return []string{"files (changed)"}, nil
+	}
+	return nil, nil
+}
+
+/*
+A deployment is a manifest of paths to asset hashes plus any
+files Pages reads as project configuration.
+*/
+func createCloudflarePagesDeployment(
+	api *cloudflareClient,
+	projectName string,
+	branch string,
+	outputDirPath string,
+	assets []*cloudflarePagesAsset,
+) (string, error) {
+	manifest := make(map[string]string)
+	for _, asset := range assets {
+		manifest[asset.path] = asset.hash
+	}
+
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	err = writer.WriteField("manifest", string(manifestData))
+	if err != nil {
+		return "", err
+	}
+
+	err = writer.WriteField("branch", branch)
+	if err != nil {
+		return "", err
+	}
+
+	for _, deploymentFile := range cloudflarePagesDeploymentFiles {
+		content, err := os.ReadFile(filepath.Join(outputDirPath, deploymentFile))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		part, err := writer.CreateFormFile(deploymentFile, deploymentFile)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = part.Write(content)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", writer.FormDataContentType())
+
+	res, err := api.Raw(
+		context.Background(),
+		http.MethodPost,
+		fmt.Sprintf("/accounts/%s/pages/projects/%s/deployments", api.account.Identifier, projectName),
+		body.Bytes(),
+		headers,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		URL string `json:"url"`
+	}
+	err = json.Unmarshal(res.Result, &result)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse Pages deployment\n%v", err)
+	}
+
+	return result.URL, nil
+}
+
+func deployCloudflarePages(api *cloudflareClient, p *processorParams, output *CloudflarePagesOutput) error {
+	c := p.config.(*CloudflarePagesConfig)
+
+	outputDirPath := cloudflarePagesOutputDirPath(p.dir, c)
+
+	assets, err := readCloudflarePagesAssets(outputDirPath)
+	if err != nil {
+		return err
+	}
+
+	output.DeploymentHash, err = hashCloudflarePagesDeployment(outputDirPath, assets)
+	if err != nil {
+		return err
+	}
+
+	assetsAPI, err := newCloudflarePagesAssetsAPI(api, output.ProjectName)
+	if err != nil {
+		return err
+	}
+
+	err = uploadMissingCloudflarePagesAssets(assetsAPI, assets)
+	if err != nil {
+		return err
+	}
+
+	output.URL, err = createCloudflarePagesDeployment(
+		api,
+		output.ProjectName,
+		cloudflarePagesProductionBranch(c),
+		outputDirPath,
+		assets,
+	)
+	return err
+}
+
+func processCloudflarePagesCreated(p *processorParams) {
+	c := p.config.(*CloudflarePagesConfig)
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	serviceBindings, err := newCloudflarePagesServiceBindings(p, c)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	project, err := api.CreatePagesProject(context.Background(), api.account, cloudflare.CreatePagesProjectParams{
+		Name:             cloudflareResourceName(c.Name),
+		ProductionBranch: cloudflarePagesProductionBranch(c),
+		DeploymentConfigs: cloudflare.PagesProjectDeploymentConfigs{
+			Production: cloudflare.PagesProjectDeploymentConfigEnvironment{
+				ServiceBindings: serviceBindings,
+			},
+		},
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	output := &CloudflarePagesOutput{
+		ProjectName: project.Name,
+		Subdomain:   project.SubDomain,
+	}
+
+	err = deployCloudflarePages(api, p, output)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.deployOutput.set(p.name, CLOUDFLARE_PAGES_CREATED, output)
+
+	p.processOkChan <- true
+}
+
+func processCloudflarePagesUpdated(p *processorParams) {
+	c := p.config.(*CloudflarePagesConfig)
+	uo, ok := p.upOutput.(*CloudflarePagesOutput)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	serviceBindings, err := newCloudflarePagesServiceBindings(p, c)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	// Removed bindings have to be sent as null to be detached.
+	services := make(map[string]interface{})
+	if upConfig, ok := p.upConfig.(*CloudflarePagesConfig); ok {
+		for _, service := range upConfig.Services {
+			services[service.Binding] = nil
+		}
+	}
+	for binding, serviceBinding := range serviceBindings {
+		services[binding] = serviceBinding
+	}
+
+	_, err = api.Raw(
+		context.Background(),
+		http.MethodPatch,
+		fmt.Sprintf("/accounts/%s/pages/projects/%s", api.account.Identifier, uo.ProjectName),
+		map[string]interface{}{
+			"production_branch": cloudflarePagesProductionBranch(c),
+			"deployment_configs": map[string]interface{}{
+				"production": map[string]interface{}{
+					"services": services,
+				},
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	output := &CloudflarePagesOutput{
+		ProjectName: uo.ProjectName,
+		Subdomain:   uo.Subdomain,
+	}
+
+	err = deployCloudflarePages(api, p, output)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.deployOutput.set(p.name, CLOUDFLARE_PAGES_UPDATED, output)
+
+	p.processOkChan <- true
+}
+
+func processCloudflarePagesDeleted(p *processorParams) {
+	uo, ok := p.upOutput.(*CloudflarePagesOutput)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	err = api.DeletePagesProject(context.Background(), api.account, uo.ProjectName)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.processOkChan <- true
+}
@@ -0,0 +1,100 @@
+package resources
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCloudflarePagesDeploymentChanges(t *testing.T) {
+	files := map[string]string{
+		"build/index.html":      "<h1>Hello</h1>",
+		"build/assets/app.js":   "console.log('hello');",
+		"build/_headers":        "/*\n  X-Frame-Options: DENY",
+		"build/node_modules/ok": "ignored",
+	}
+
+	tests := []struct {
+		name     string
+		edit     func(dir string) error
+		expected []string
+	}{
+		{
+			name:     "unchanged files",
+			edit:     func(dir string) error { return nil },
+			expected: nil,
+		},
+		{
+			name: "changed asset",
+			edit: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "build", "index.html"), []byte("<h1>Bye</h1>"), 0644)
+			},
+			expected: []string{"files (changed)"},
+		},
+		{
+			name: "removed asset",
+			edit: func(dir string) error {
+				return os.Remove(filepath.Join(dir, "build", "assets", "app.js"))
+			},
+			expected: []string{"files (changed)"},
+		},
+		{
+			name: "changed deployment file",
+			edit: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "build", "_headers"), []byte("/*\n  X-Frame-Options: SAMEORIGIN"), 0644)
+			},
+			expected: []string{"files (changed)"},
+		},
+		{
+			name: "changed ignored file",
+			edit: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "build", "node_modules", "ok"), []byte("still ignored"), 0644)
+			},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for path, content := range files {
+				path = filepath.Join(dir, path)
+				err := os.MkdirAll(filepath.Dir(path), 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(path, []byte(content), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c := &CloudflarePagesConfig{ConfigCommon: ConfigCommon{Type: "cloudflare-pages", Name: "CORE_APP_PAGES"}}
+			outputDirPath := cloudflarePagesOutputDirPath(dir, c)
+
+			assets, err := readCloudflarePagesAssets(outputDirPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash, err := hashCloudflarePagesDeployment(outputDirPath, assets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			uo := &CloudflarePagesOutput{ProjectName: "project-core-app-pages", DeploymentHash: hash}
+
+			err = tt.edit(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := cloudflarePagesDeploymentChanges(dir, c, uo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("got %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"gas/helpers"
+	"strings"
+)
+
+/*
+Accounts are named "default" in messages when a resource
+doesn't set one.
+*/
+func cloudflareAccountDisplayName(account string) string {
+	if account == "" {
+		return defaultCloudflareAccount
+	}
+	return account
+}
+
+/*
+Permissions are checked against the permission groups of the
+token's policies by name (e.g. "Workers Scripts Write").
+Reading a token's policies needs the token to be allowed to
+read itself (API Tokens Read), which least-privilege tokens
+usually aren't. In that case only its status is checked and
+preflight passes with a warning, rather than every CI token
+needing a permission gas doesn't otherwise use. A missing
+permission then fails the deploy at the first API call that
+needs it.
+*/
+func checkCloudflareTokenPermissions(account string, required []string) error {
+	client, err := newCloudflareClient(account)
+	if err != nil {
+		return err
+	}
+
+	name := cloudflareAccountDisplayName(account)
+
+	verified, err := client.VerifyAPIToken(context.Background())
+	if err != nil {
+		return fmt.Errorf("unable to verify API token of account %s\n%v", name, err)
+	}
+	if verified.Status != "active" {
+		return fmt.Errorf("API token of account %s is %s", name, verified.Status)
+	}
+
+	token, err := client.GetAPIToken(context.Background(), verified.ID)
+	if err != nil {
+		fmt.Printf("Warning: unable to read permissions of API token of account %s (it needs API Tokens Read to be checked), skipping permission check\n", name)
+		return nil
+	}
+
+	allowed := make([]string, 0)
+	denied := make([]string, 0)
+	for _, policy := range token.Policies {
+		for _, group := range policy.PermissionGroups {
+			if policy.Effect == "deny" {
+				denied = append(denied, group.Name)
+			} else {
+				allowed = append(allowed, group.Name)
+			}
+		}
+	}
+
+	missing := make([]string, 0)
+	for _, permission := range required {
+		if !helpers.IsStringInSlice(allowed, permission) || helpers.IsStringInSlice(denied, permission) {
+			missing = append(missing, permission)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("API token of account %s is missing permissions -> %s\nsee gas auth required-permissions", name, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+const (
+	CLOUDFLARE_QUEUE_CREATED processorKeyType = "cloudflare-queue:CREATED"
+	CLOUDFLARE_QUEUE_DELETED processorKeyType = "cloudflare-queue:DELETED"
+	CLOUDFLARE_QUEUE_UPDATED processorKeyType = "cloudflare-queue:UPDATED"
+)
+
+type CloudflareQueueConfig struct {
+	ConfigCommon
+}
+
+type CloudflareQueueOutput struct {
+	ID        string `json:"id"`
+	QueueName string `json:"queueName"`
+}
+
+func init() {
+	registerConfig("cloudflare-queue", func(config config) interface{} {
+		return decodeConfig(config, &CloudflareQueueConfig{})
+	})
+
+	registerUpOutput("cloudflare-queue", func(output upOutput) interface{} {
+		return decodeUpOutput(output, &CloudflareQueueOutput{})
+	})
+
+	registerDeployOutput(CLOUDFLARE_QUEUE_CREATED, func(res interface{}) interface{} {
+		r := res.(cloudflare.Queue)
+
+		return &CloudflareQueueOutput{
+			ID:        r.ID,
+			QueueName: r.Name,
+		}
+	})
+
+	registerReplaceFields("cloudflare-queue", "name")
+
+	registerPermissions("cloudflare-queue", func(config interface{}, state stateType) []string {
+		return []string{"Queues Write"}
+	})
+
+	registerProcessor(CLOUDFLARE_QUEUE_CREATED, processCloudflareQueueCreated)
+	registerProcessor(CLOUDFLARE_QUEUE_DELETED, processCloudflareQueueDeleted)
+	registerProcessor(CLOUDFLARE_QUEUE_UPDATED, processCloudflareQueueUpdated)
+
+	registerCloudflareWorkerBindings(setCloudflareWorkerQueueProducerBindings)
+	registerConfigRefs("cloudflare-worker", cloudflareWorkerQueueRefs)
+
+	registerPermissions("cloudflare-worker", func(config interface{}, state stateType) []string {
+		if len(cloudflareWorkerQueueConsumers(config)) > 0 {
+			return []string{"Queues Write"}
+		}
+		return nil
+	})
+
+	registerCloudflareWorkerSubresource(&cloudflareWorkerSubresource{
+		put:    putCloudflareWorkerQueueConsumers,
+		remove: removeCloudflareWorkerQueueConsumers,
+	})
+}
+
+func cloudflareQueueName(p *processorParams, queue string) (string, error) {
+	output, err := p.depOutputByConfigName("cloudflare-queue", queue)
+	if err != nil {
+		return "", err
+	}
+	return output.(*CloudflareQueueOutput).QueueName, nil
+}
+
+/*
+Producer bindings are named after the queue resource they
+bind to, like KV bindings (see cloudflareKvNamespaceID).
+*/
+func setCloudflareWorkerQueueProducerBindings(p *processorParams, c *CloudflareWorkerConfig, bindings cloudflareWorkerBindings) error {
+	if c.Queues == nil {
+		return nil
+	}
+	for _, producer := range c.Queues.Producers {
+		queueName, err := cloudflareQueueName(p, producer.Binding)
+		if err != nil {
+			return err
+		}
+		bindings[producer.Binding] = cloudflare.WorkerQueueBinding{
+			Binding: producer.Binding,
+			Queue:   queueName,
+		}
+	}
+	return nil
+}
+
+func cloudflareWorkerQueueRefs(config interface{}) []string {
+	c := config.(*CloudflareWorkerConfig)
+	result := make([]string, 0)
+	if c.Queues == nil {
+		return result
+	}
+	for _, producer := range c.Queues.Producers {
+		result = append(result, producer.Binding)
+	}
+	for _, consumer := range c.Queues.Consumers {
+		result = append(result, consumer.Queue, consumer.DeadLetterQueue)
+	}
+	return result
+}
+
+func cloudflareWorkerQueueConsumers(config interface{}) []CloudflareWorkerQueueConsumer {
+	c, ok := config.(*CloudflareWorkerConfig)
+	if !ok || c.Queues == nil {
+		return make([]CloudflareWorkerQueueConsumer, 0)
+	}
+	return c.Queues.Consumers
+}
+
+func newCloudflareQueueConsumer(p *processorParams, scriptName string, consumer CloudflareWorkerQueueConsumer) (cloudflare.QueueConsumer, error) {
+	result := cloudflare.QueueConsumer{
+		Name:       scriptName,
+		ScriptName: scriptName,
+		Settings: cloudflare.QueueConsumerSettings{
+			BatchSize:   consumer.MaxBatchSize,
+			MaxRetires:  consumer.MaxRetries,
+			MaxWaitTime: consumer.MaxWaitTimeMs,
+		},
+	}
+
+	if consumer.DeadLetterQueue != "" {
+		deadLetterQueueName, err := cloudflareQueueName(p, consumer.DeadLetterQueue)
+		if err != nil {
+			return result, err
+		}
+		result.DeadLetterQueue = deadLetterQueueName
+	}
+
+	return result, nil
+}
+
+/*
+Consumers are registered after the worker script is uploaded
+because a queue can only be consumed by an existing script.
+Consumers are matched with the up output's consumers by queue
+name to work out which ones to create, update, or remove. The
+up output keeps the names because the up config's queues may
+have been renamed or removed since.
+*/
+func putCloudflareWorkerQueueConsumers(api *cloudflareClient, p *processorParams, output *CloudflareWorkerOutput) error {
+	uo, _ := p.upOutput.(*CloudflareWorkerOutput)
+
+	upQueueNames := make(map[string]bool)
+	if uo != nil {
+		for _, queueName := range uo.QueueConsumers {
+			upQueueNames[queueName] = true
+		}
+	}
+
+	for _, consumer := range cloudflareWorkerQueueConsumers(p.config) {
+		queueName, err := cloudflareQueueName(p, consumer.Queue)
+		if err != nil {
+			return err
+		}
+
+		queueConsumer, err := newCloudflareQueueConsumer(p, output.ScriptName, consumer)
+		if err != nil {
+			return err
+		}
+
+		if upQueueNames[queueName] {
+			_, err = api.UpdateQueueConsumer(context.Background(), api.account, cloudflare.UpdateQueueConsumerParams{
+				QueueName: queueName,
+				Consumer:  queueConsumer,
+			})
+		} else {
+			_, err = api.CreateQueueConsumer(context.Background(), api.account, cloudflare.CreateQueueConsumerParams{
+				QueueName: queueName,
+				Consumer:  queueConsumer,
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("unable to set %s consumer of queue %s\n%v", output.ScriptName, queueName, err)
+		}
+
+		output.QueueConsumers = append(output.QueueConsumers, queueName)
+		delete(upQueueNames, queueName)
+	}
+
+	// What's left are consumers that were removed from config.
+	for queueName := range upQueueNames {
+		err := removeCloudflareQueueConsumer(api, queueName, uo.ScriptName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func removeCloudflareWorkerQueueConsumers(api *cloudflareClient, p *processorParams, upOutput *CloudflareWorkerOutput) error {
+	for _, queueName := range upOutput.QueueConsumers {
+		err := removeCloudflareQueueConsumer(api, queueName, upOutput.ScriptName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+A consumer whose queue was already deleted (e.g. because the
+queue was replaced) was deleted with it.
+*/
+func removeCloudflareQueueConsumer(api *cloudflareClient, queueName string, scriptName string) error {
+	err := api.DeleteQueueConsumer(context.Background(), api.account, cloudflare.DeleteQueueConsumerParams{
+		QueueName:    queueName,
+		ConsumerName: scriptName,
+	})
+	if err != nil {
+		var notFoundErr *cloudflare.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return nil
+		}
+		return fmt.Errorf("unable to remove %s consumer of queue %s\n%v", scriptName, queueName, err)
+	}
+
+	return nil
+}
+
+func processCloudflareQueueCreated(p *processorParams) {
+	c := p.config.(*CloudflareQueueConfig)
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	res, err := api.CreateQueue(context.Background(), api.account, cloudflare.CreateQueueParams{
+		Name: cloudflareResourceName(c.Name),
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.deployOutput.set(p.name, CLOUDFLARE_QUEUE_CREATED, res)
+
+	p.processOkChan <- true
+}
+
+/*
+A queue's only config field is its name, which can't be
+updated in place. So a queue is only UPDATED in place when
+its deps change, which requires no API calls.
+*/
+func processCloudflareQueueUpdated(p *processorParams) {
+	p.processOkChan <- true
+}
+
+func processCloudflareQueueDeleted(p *processorParams) {
+	uo, ok := p.upOutput.(*CloudflareQueueOutput)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	err = api.DeleteQueue(context.Background(), api.account, uo.QueueName)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.processOkChan <- true
+}
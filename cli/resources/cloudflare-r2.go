@@ -0,0 +1,310 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+const (
+	CLOUDFLARE_R2_CREATED processorKeyType = "cloudflare-r2:CREATED"
+	CLOUDFLARE_R2_DELETED processorKeyType = "cloudflare-r2:DELETED"
+	CLOUDFLARE_R2_UPDATED processorKeyType = "cloudflare-r2:UPDATED"
+)
+
+type CloudflareR2Config struct {
+	ConfigCommon
+	LocationHint string                      `json:"locationHint,omitempty" schema:"enum=wnam|enam|weur|eeur|apac|oc"`
+	Cors         []CloudflareR2CorsRule      `json:"cors,omitempty"`
+	Lifecycle    []CloudflareR2LifecycleRule `json:"lifecycle,omitempty"`
+}
+
+type CloudflareR2CorsRule struct {
+	AllowedOrigins []string `json:"allowedOrigins"`
+	AllowedMethods []string `json:"allowedMethods"`
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+	ExposeHeaders  []string `json:"exposeHeaders,omitempty"`
+	MaxAgeSeconds  int      `json:"maxAgeSeconds,omitempty"`
+}
+
+/*
+Lifecycle rules delete objects, or abort incomplete multipart
+uploads, a number of days after they're created. Rules can be
+limited to objects with a key prefix.
+*/
+type CloudflareR2LifecycleRule struct {
+	ID                             string `json:"id"`
+	Enabled                        *bool  `json:"enabled,omitempty"`
+	Prefix                         string `json:"prefix,omitempty"`
+	ExpireAfterDays                int    `json:"expireAfterDays,omitempty"`
+	AbortMultipartUploadsAfterDays int    `json:"abortMultipartUploadsAfterDays,omitempty"`
+}
+
+type CloudflareR2Output struct {
+	BucketName string `json:"bucketName"`
+}
+
+func init() {
+	registerConfig("cloudflare-r2", func(config config) interface{} {
+		return decodeConfig(config, &CloudflareR2Config{})
+	})
+
+	registerUpOutput("cloudflare-r2", func(output upOutput) interface{} {
+		return decodeUpOutput(output, &CloudflareR2Output{})
+	})
+
+	registerDeployOutput(CLOUDFLARE_R2_CREATED, func(res interface{}) interface{} {
+		r := res.(cloudflare.R2Bucket)
+
+		return &CloudflareR2Output{
+			BucketName: r.Name,
+		}
+	})
+
+	// Buckets can't be renamed or moved.
+	registerReplaceFields("cloudflare-r2", "name", "locationHint")
+
+	registerReplaceWarning("cloudflare-r2", "the bucket's objects will be lost")
+
+	registerPermissions("cloudflare-r2", func(config interface{}, state stateType) []string {
+		return []string{"Workers R2 Storage Write"}
+	})
+
+	registerProcessor(CLOUDFLARE_R2_CREATED, processCloudflareR2Created)
+	registerProcessor(CLOUDFLARE_R2_DELETED, processCloudflareR2Deleted)
+	registerProcessor(CLOUDFLARE_R2_UPDATED, processCloudflareR2Updated)
+
+	registerCloudflareWorkerBindings(setCloudflareWorkerR2Bindings)
+	registerConfigRefs("cloudflare-worker", cloudflareWorkerR2Refs)
+}
+
+const cloudflareR2SecondsPerDay = 24 * 60 * 60
+
+func putCloudflareR2Cors(api *cloudflareClient, bucketName string, rules []CloudflareR2CorsRule) error {
+	uri := fmt.Sprintf("/accounts/%s/r2/buckets/%s/cors", api.account.Identifier, bucketName)
+
+	if len(rules) == 0 {
+		_, err := api.Raw(context.Background(), http.MethodDelete, uri, nil, nil)
+		return err
+	}
+
+	body := make([]map[string]interface{}, 0)
+	for _, rule := range rules {
+		body = append(body, map[string]interface{}{
+			"allowed": map[string]interface{}{
+				"origins": rule.AllowedOrigins,
+				"methods": rule.AllowedMethods,
+				"headers": rule.AllowedHeaders,
+			},
+			"exposeHeaders": rule.ExposeHeaders,
+			"maxAgeSeconds": rule.MaxAgeSeconds,
+		})
+	}
+
+	_, err := api.Raw(context.Background(), http.MethodPut, uri, map[string]interface{}{
+		"rules": body,
+	}, nil)
+	return err
+}
+
+/*
+Putting an empty list of rules removes every lifecycle rule.
+*/
+func putCloudflareR2Lifecycle(api *cloudflareClient, bucketName string, rules []CloudflareR2LifecycleRule) error {
+	body := make([]map[string]interface{}, 0)
+	for _, rule := range rules {
+		enabled := true
+		if rule.Enabled != nil {
+			enabled = *rule.Enabled
+		}
+
+		r := map[string]interface{}{
+			"id":      rule.ID,
+			"enabled": enabled,
+			"conditions": map[string]interface{}{
+				"prefix": rule.Prefix,
+			},
+		}
+
+		if rule.ExpireAfterDays > 0 {
+			r["deleteObjectsTransition"] = map[string]interface{}{
+				"condition": map[string]interface{}{
+					"type":   "Age",
+					"maxAge": rule.ExpireAfterDays * cloudflareR2SecondsPerDay,
+				},
+			}
+		}
+
+		if rule.AbortMultipartUploadsAfterDays > 0 {
+			r["abortMultipartUploadsTransition"] = map[string]interface{}{
+				"condition": map[string]interface{}{
+					"type":   "Age",
+					"maxAge": rule.AbortMultipartUploadsAfterDays * cloudflareR2SecondsPerDay,
+				},
+			}
+		}
+
+		body = append(body, r)
+	}
+
+	_, err := api.Raw(
+		context.Background(),
+		http.MethodPut,
+		fmt.Sprintf("/accounts/%s/r2/buckets/%s/lifecycle", api.account.Identifier, bucketName),
+		map[string]interface{}{
+			"rules": body,
+		},
+		nil,
+	)
+	return err
+}
+
+func cloudflareWorkerR2Refs(config interface{}) []string {
+	result := make([]string, 0)
+	for _, r2 := range config.(*CloudflareWorkerConfig).R2 {
+		result = append(result, r2.Binding)
+	}
+	return result
+}
+
+func setCloudflareWorkerR2Bindings(p *processorParams, c *CloudflareWorkerConfig, bindings cloudflareWorkerBindings) error {
+	for _, r2 := range c.R2 {
+		output, err := p.depOutputByConfigName("cloudflare-r2", r2.Binding)
+		if err != nil {
+			return err
+		}
+		bindings[r2.Binding] = cloudflare.WorkerR2BucketBinding{
+			BucketName: output.(*CloudflareR2Output).BucketName,
+		}
+	}
+	return nil
+}
+
+/*
+Bucket names include the location hint, if there is one, so a
+replacement bucket in another location can be created before
+the bucket it replaces is deleted.
+
+CORE_FILES, weur -> project-core-files-weur
+*/
+func newCloudflareR2BucketName(c *CloudflareR2Config) string {
+	if c.LocationHint == "" {
+		return cloudflareResourceName(c.Name)
+	}
+	return cloudflareResourceName(c.Name) + "-" + c.LocationHint
+}
+
+func processCloudflareR2Created(p *processorParams) {
+	c := p.config.(*CloudflareR2Config)
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	res, err := api.CreateR2Bucket(context.Background(), api.account, cloudflare.CreateR2BucketParameters{
+		Name:         newCloudflareR2BucketName(c),
+		LocationHint: c.LocationHint,
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	if len(c.Cors) > 0 {
+		err = putCloudflareR2Cors(api, res.Name, c.Cors)
+	}
+	if err == nil && len(c.Lifecycle) > 0 {
+		err = putCloudflareR2Lifecycle(api, res.Name, c.Lifecycle)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		deleteCloudflareR2BucketOfFailedCreate(api, res.Name)
+		p.processOkChan <- false
+		return
+	}
+
+	// The output is only set once the bucket has its rules,
+	// otherwise it'd be saved with a config it doesn't have.
+	p.deployOutput.set(p.name, CLOUDFLARE_R2_CREATED, res)
+
+	p.processOkChan <- true
+}
+
+/*
+A bucket whose rules couldn't be put is deleted so the create
+can be retried from scratch. It's new, so it's empty.
+*/
+func deleteCloudflareR2BucketOfFailedCreate(api *cloudflareClient, bucketName string) {
+	err := api.DeleteR2Bucket(context.Background(), api.account, bucketName)
+	if err != nil {
+		fmt.Printf("Error: unable to delete bucket %s after its rules couldn't be put, delete it before deploying again\n%v\n", bucketName, err)
+	}
+}
+
+/*
+Only the settings that changed are put, so updating CORS
+rules doesn't touch lifecycle rules and vice versa.
+*/
+func processCloudflareR2Updated(p *processorParams) {
+	c := p.config.(*CloudflareR2Config)
+	uo, ok := p.upOutput.(*CloudflareR2Output)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	for _, change := range diffConfigs(p.upConfig, p.config) {
+		switch change.field {
+		case "cors":
+			err = putCloudflareR2Cors(api, uo.BucketName, c.Cors)
+		case "lifecycle":
+			err = putCloudflareR2Lifecycle(api, uo.BucketName, c.Lifecycle)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			p.processOkChan <- false
+			return
+		}
+	}
+
+	p.processOkChan <- true
+}
+
+func processCloudflareR2Deleted(p *processorParams) {
+	uo, ok := p.upOutput.(*CloudflareR2Output)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	err = api.DeleteR2Bucket(context.Background(), api.account, uo.BucketName)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.processOkChan <- true
+}
@@ -0,0 +1,315 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gas/helpers"
+	"net/http"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+const (
+	CLOUDFLARE_VECTORIZE_CREATED processorKeyType = "cloudflare-vectorize:CREATED"
+	CLOUDFLARE_VECTORIZE_DELETED processorKeyType = "cloudflare-vectorize:DELETED"
+	CLOUDFLARE_VECTORIZE_UPDATED processorKeyType = "cloudflare-vectorize:UPDATED"
+)
+
+type CloudflareVectorizeConfig struct {
+	ConfigCommon
+	Dimensions      int                                `json:"dimensions" schema:"minimum=1,maximum=1536"`
+	Metric          string                             `json:"metric" schema:"enum=cosine|euclidean|dot-product"`
+	MetadataIndexes []CloudflareVectorizeMetadataIndex `json:"metadataIndexes,omitempty" schema:"maxItems=10"`
+}
+
+type CloudflareVectorizeMetadataIndex struct {
+	PropertyName string `json:"propertyName"`
+	IndexType    string `json:"indexType" schema:"enum=string|number|boolean"`
+}
+
+type CloudflareVectorizeOutput struct {
+	IndexName string `json:"indexName"`
+}
+
+func init() {
+	registerConfig("cloudflare-vectorize", func(config config) interface{} {
+		return decodeConfig(config, &CloudflareVectorizeConfig{})
+	})
+
+	registerUpOutput("cloudflare-vectorize", func(output upOutput) interface{} {
+		return decodeUpOutput(output, &CloudflareVectorizeOutput{})
+	})
+
+	registerDeployOutput(CLOUDFLARE_VECTORIZE_CREATED, func(res interface{}) interface{} {
+		return res.(*CloudflareVectorizeOutput)
+	})
+
+	// Indexes can't be renamed or reconfigured, and their
+	// vectors aren't copied to the replacement.
+	registerReplaceFields("cloudflare-vectorize", "name", "dimensions", "metric")
+	registerReplaceWarning("cloudflare-vectorize", "the index's vectors will be lost")
+
+	registerValidator("cloudflare-vectorize", validateCloudflareVectorizeConfig)
+
+	registerPermissions("cloudflare-vectorize", func(config interface{}, state stateType) []string {
+		return []string{"Vectorize Write"}
+	})
+
+	registerProcessor(CLOUDFLARE_VECTORIZE_CREATED, processCloudflareVectorizeCreated)
+	registerProcessor(CLOUDFLARE_VECTORIZE_DELETED, processCloudflareVectorizeDeleted)
+	registerProcessor(CLOUDFLARE_VECTORIZE_UPDATED, processCloudflareVectorizeUpdated)
+
+	registerCloudflareWorkerBindings(setCloudflareWorkerVectorizeBindings)
+	registerConfigRefs("cloudflare-worker", cloudflareWorkerVectorizeRefs)
+}
+
+/*
+Dimensions, metric and metadata index types are checked by
+the config's schema.
+*/
+func validateCloudflareVectorizeConfig(config interface{}) error {
+	c := config.(*CloudflareVectorizeConfig)
+
+	propertyNames := make([]string, 0, len(c.MetadataIndexes))
+	for _, metadataIndex := range c.MetadataIndexes {
+		if metadataIndex.PropertyName == "" {
+			return fmt.Errorf("metadata index propertyName is required")
+		}
+		if helpers.IsStringInSlice(propertyNames, metadataIndex.PropertyName) {
+			return fmt.Errorf("metadata index %s is defined more than once", metadataIndex.PropertyName)
+		}
+		propertyNames = append(propertyNames, metadataIndex.PropertyName)
+	}
+
+	return nil
+}
+
+func cloudflareVectorizeIndexName(p *processorParams, binding string) (string, error) {
+	output, err := p.depOutputByConfigName("cloudflare-vectorize", binding)
+	if err != nil {
+		return "", err
+	}
+	return output.(*CloudflareVectorizeOutput).IndexName, nil
+}
+
+/*
+cloudflare-go has no Vectorize binding type, so it's
+uploaded as a raw binding.
+*/
+func cloudflareWorkerVectorizeRefs(config interface{}) []string {
+	result := make([]string, 0)
+	for _, vectorize := range config.(*CloudflareWorkerConfig).Vectorize {
+		result = append(result, vectorize.Binding)
+	}
+	return result
+}
+
+func setCloudflareWorkerVectorizeBindings(p *processorParams, c *CloudflareWorkerConfig, bindings cloudflareWorkerBindings) error {
+	for _, vectorize := range c.Vectorize {
+		indexName, err := cloudflareVectorizeIndexName(p, vectorize.Binding)
+		if err != nil {
+			return err
+		}
+		bindings[vectorize.Binding] = cloudflare.UnsafeBinding{
+			"type":       "vectorize",
+			"index_name": indexName,
+		}
+	}
+	return nil
+}
+
+/*
+Index names include the dimensions and metric, so a replacement
+index can be created before the index it replaces is deleted.
+
+core-vectors, 768, cosine -> project-core-vectors-768-cosine
+*/
+func newCloudflareVectorizeIndexName(c *CloudflareVectorizeConfig) string {
+	return fmt.Sprintf("%s-%d-%s", cloudflareResourceName(c.Name), c.Dimensions, c.Metric)
+}
+
+func cloudflareVectorizeIndexesURI(api *cloudflareClient) string {
+	return fmt.Sprintf("/accounts/%s/vectorize/v2/indexes", api.account.Identifier)
+}
+
+func putCloudflareVectorizeMetadataIndex(api *cloudflareClient, indexName string, metadataIndex CloudflareVectorizeMetadataIndex) error {
+	_, err := api.Raw(
+		context.Background(),
+		http.MethodPost,
+		fmt.Sprintf("%s/%s/metadata_index/create", cloudflareVectorizeIndexesURI(api), indexName),
+		map[string]interface{}{
+			"propertyName": metadataIndex.PropertyName,
+			"indexType":    metadataIndex.IndexType,
+		},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to create metadata index %s of %s\n%v", metadataIndex.PropertyName, indexName, err)
+	}
+	return nil
+}
+
+func removeCloudflareVectorizeMetadataIndex(api *cloudflareClient, indexName string, propertyName string) error {
+	_, err := api.Raw(
+		context.Background(),
+		http.MethodPost,
+		fmt.Sprintf("%s/%s/metadata_index/delete", cloudflareVectorizeIndexesURI(api), indexName),
+		map[string]interface{}{
+			"propertyName": propertyName,
+		},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to remove metadata index %s of %s\n%v", propertyName, indexName, err)
+	}
+	return nil
+}
+
+func processCloudflareVectorizeCreated(p *processorParams) {
+	c := p.config.(*CloudflareVectorizeConfig)
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	res, err := api.Raw(
+		context.Background(),
+		http.MethodPost,
+		cloudflareVectorizeIndexesURI(api),
+		map[string]interface{}{
+			"name": newCloudflareVectorizeIndexName(c),
+			"config": map[string]interface{}{
+				"dimensions": c.Dimensions,
+				"metric":     c.Metric,
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	var index struct {
+		Name string `json:"name"`
+	}
+	err = json.Unmarshal(res.Result, &index)
+	if err != nil {
+		fmt.Println("Error:", fmt.Errorf("unable to parse created index\n%v", err))
+		p.processOkChan <- false
+		return
+	}
+
+	for _, metadataIndex := range c.MetadataIndexes {
+		err = putCloudflareVectorizeMetadataIndex(api, index.Name, metadataIndex)
+		if err != nil {
+			fmt.Println("Error:", err)
+			p.processOkChan <- false
+			return
+		}
+	}
+
+	p.deployOutput.set(p.name, CLOUDFLARE_VECTORIZE_CREATED, &CloudflareVectorizeOutput{
+		IndexName: index.Name,
+	})
+
+	p.processOkChan <- true
+}
+
+/*
+Only metadata indexes are updated in place. A metadata index
+whose type changed is removed and created again.
+*/
+func processCloudflareVectorizeUpdated(p *processorParams) {
+	c := p.config.(*CloudflareVectorizeConfig)
+	uc, ok := p.upConfig.(*CloudflareVectorizeConfig)
+	if !ok {
+		fmt.Println("Error:", p.upConfigErr())
+		p.processOkChan <- false
+		return
+	}
+	uo, ok := p.upOutput.(*CloudflareVectorizeOutput)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	for _, upMetadataIndex := range uc.MetadataIndexes {
+		if findCloudflareVectorizeMetadataIndex(c.MetadataIndexes, upMetadataIndex) {
+			continue
+		}
+		err = removeCloudflareVectorizeMetadataIndex(api, uo.IndexName, upMetadataIndex.PropertyName)
+		if err != nil {
+			fmt.Println("Error:", err)
+			p.processOkChan <- false
+			return
+		}
+	}
+
+	for _, metadataIndex := range c.MetadataIndexes {
+		if findCloudflareVectorizeMetadataIndex(uc.MetadataIndexes, metadataIndex) {
+			continue
+		}
+		err = putCloudflareVectorizeMetadataIndex(api, uo.IndexName, metadataIndex)
+		if err != nil {
+			fmt.Println("Error:", err)
+			p.processOkChan <- false
+			return
+		}
+	}
+
+	p.processOkChan <- true
+}
+
+func findCloudflareVectorizeMetadataIndex(metadataIndexes []CloudflareVectorizeMetadataIndex, metadataIndex CloudflareVectorizeMetadataIndex) bool {
+	for _, item := range metadataIndexes {
+		if item == metadataIndex {
+			return true
+		}
+	}
+	return false
+}
+
+func processCloudflareVectorizeDeleted(p *processorParams) {
+	uo, ok := p.upOutput.(*CloudflareVectorizeOutput)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	_, err = api.Raw(
+		context.Background(),
+		http.MethodDelete,
+		fmt.Sprintf("%s/%s", cloudflareVectorizeIndexesURI(api), uo.IndexName),
+		nil,
+		nil,
+	)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.processOkChan <- true
+}
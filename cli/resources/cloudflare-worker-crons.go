@@ -0,0 +1,189 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+func init() {
+	registerValidator("cloudflare-worker", func(config interface{}) error {
+		for _, cron := range config.(*CloudflareWorkerConfig).Crons {
+			err := validateCloudflareWorkerCron(cron)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	registerCloudflareWorkerSubresource(&cloudflareWorkerSubresource{
+		put:    putCloudflareWorkerCrons,
+		remove: removeCloudflareWorkerCrons,
+	})
+}
+
+type cloudflareWorkerCronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+	// Special characters allowed in the field besides * , - /
+	special string
+}
+
+/*
+Cloudflare crons have five fields. Months and days of the
+week can be names (JAN, MON). Days of the month accept L
+(last day) and W (nearest weekday), and days of the week
+accept L (last) and # (nth).
+*/
+var cloudflareWorkerCronFields = []cloudflareWorkerCronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31, special: "LW"},
+	{name: "month", min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	{name: "day of week", min: 1, max: 7, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}, special: "L#"},
+}
+
+func validateCloudflareWorkerCron(cron string) error {
+	fields := strings.Fields(cron)
+	if len(fields) != len(cloudflareWorkerCronFields) {
+		return fmt.Errorf("cron %q must have %d fields (minute hour day-of-month month day-of-week), got %d", cron, len(cloudflareWorkerCronFields), len(fields))
+	}
+
+	for i, field := range fields {
+		err := cloudflareWorkerCronFields[i].validate(field)
+		if err != nil {
+			return fmt.Errorf("cron %q has an invalid %s field: %v", cron, cloudflareWorkerCronFields[i].name, err)
+		}
+	}
+
+	return nil
+}
+
+func (f cloudflareWorkerCronField) validate(field string) error {
+	for _, item := range strings.Split(field, ",") {
+		err := f.validateItem(strings.ToUpper(item))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f cloudflareWorkerCronField) validateItem(item string) error {
+	if item == "" {
+		return fmt.Errorf("empty value")
+	}
+
+	rangePart, step, hasStep := strings.Cut(item, "/")
+	if hasStep {
+		n, err := strconv.Atoi(step)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid step %q", step)
+		}
+	}
+
+	if rangePart == "*" {
+		return nil
+	}
+
+	if strings.Contains(f.special, "L") && rangePart == "L" {
+		return nil
+	}
+
+	if strings.Contains(f.special, "#") && strings.Contains(rangePart, "#") {
+		day, nth, _ := strings.Cut(rangePart, "#")
+		n, err := strconv.Atoi(nth)
+		if err != nil || n < 1 || n > 5 {
+			return fmt.Errorf("invalid nth %q", nth)
+		}
+		return f.validateValue(day)
+	}
+
+	if strings.Contains(f.special, "W") && strings.HasSuffix(rangePart, "W") {
+		return f.validateValue(strings.TrimSuffix(rangePart, "W"))
+	}
+
+	if strings.Contains(f.special, "L") && strings.HasSuffix(rangePart, "L") && len(rangePart) > 1 {
+		return f.validateValue(strings.TrimSuffix(rangePart, "L"))
+	}
+
+	from, to, isRange := strings.Cut(rangePart, "-")
+	if !isRange {
+		return f.validateValue(from)
+	}
+
+	fromValue, err := f.value(from)
+	if err != nil {
+		return err
+	}
+	toValue, err := f.value(to)
+	if err != nil {
+		return err
+	}
+	if fromValue > toValue {
+		return fmt.Errorf("invalid range %q", rangePart)
+	}
+
+	return nil
+}
+
+func (f cloudflareWorkerCronField) validateValue(value string) error {
+	_, err := f.value(value)
+	return err
+}
+
+func (f cloudflareWorkerCronField) value(value string) (int, error) {
+	for i, name := range f.names {
+		if value == name {
+			return f.min + i, nil
+		}
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("%q is not between %d and %d", value, f.min, f.max)
+	}
+
+	return n, nil
+}
+
+/*
+Crons are only put if they're configured or were configured
+before, so workers that don't use them are left as is.
+*/
+func putCloudflareWorkerCrons(api *cloudflareClient, p *processorParams, output *CloudflareWorkerOutput) error {
+	c := p.config.(*CloudflareWorkerConfig)
+	uc, _ := p.upConfig.(*CloudflareWorkerConfig)
+
+	if len(c.Crons) == 0 && (uc == nil || len(uc.Crons) == 0) {
+		return nil
+	}
+
+	crons := make([]cloudflare.WorkerCronTrigger, 0, len(c.Crons))
+	for _, cron := range c.Crons {
+		crons = append(crons, cloudflare.WorkerCronTrigger{Cron: cron})
+	}
+
+	_, err := api.UpdateWorkerCronTriggers(context.Background(), api.account, cloudflare.UpdateWorkerCronTriggersParams{
+		ScriptName: output.ScriptName,
+		Crons:      crons,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set crons of %s\n%v", output.ScriptName, err)
+	}
+
+	return nil
+}
+
+/*
+Crons are deleted with their script.
+*/
+func removeCloudflareWorkerCrons(api *cloudflareClient, p *processorParams, upOutput *CloudflareWorkerOutput) error {
+	return nil
+}
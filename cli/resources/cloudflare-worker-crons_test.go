@@ -0,0 +1,110 @@
+package resources
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/*
+Invalid crons fail the plan with the location of the worker's
+config, and every invalid config is reported.
+*/
+func TestInvalidCronsAreLocated(t *testing.T) {
+	apiDir := t.TempDir()
+	jobsDir := t.TempDir()
+	for _, dir := range []string{apiDir, jobsDir} {
+		err := os.MkdirAll(filepath.Join(dir, "src"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.WriteFile(filepath.Join(apiDir, "src", "index.ts"), []byte("import { Worker } from \"@gas/resources\"\n\nexport const coreBaseApi: Worker = {\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(jobsDir, "src", "index.ts"), []byte("export const coreBaseJobs = {\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestResources(t, newTestUpJsonPath(t, "{}"), map[string][]*exportedConfig{
+		apiDir: {
+			{ExportName: "coreBaseApi", Config: config{"type": "cloudflare-worker", "name": "CORE_BASE_API", "crons": []interface{}{"*/5 * * * *", "61 * * * *"}}},
+		},
+		jobsDir: {
+			{ExportName: "coreBaseJobs", Config: config{"type": "cloudflare-worker", "name": "CORE_BASE_JOBS", "crons": []interface{}{"0 0 * *"}}},
+		},
+		t.TempDir(): {
+			{ExportName: "coreBaseWeb", Config: config{"type": "cloudflare-worker", "name": "CORE_BASE_WEB", "crons": []interface{}{"0 9 * JAN-MAR MON#2", "0 0 L * *"}}},
+		},
+	})
+
+	expected := []string{
+		filepath.Join(apiDir, "src", "index.ts") + `:3: cron "61 * * * *" has an invalid minute field`,
+		filepath.Join(jobsDir, "src", "index.ts") + `:1: cron "0 0 * *" must have 5 fields`,
+	}
+
+	problems := r.validateNameToConfig()
+	if len(problems) != len(expected) {
+		t.Fatalf("got problems %q, expected %d", problems, len(expected))
+	}
+	for _, problem := range expected {
+		found := false
+		for _, result := range problems {
+			found = found || strings.HasPrefix(result, problem)
+		}
+		if !found {
+			t.Errorf("got problems %q, expected one starting with %q", problems, problem)
+		}
+	}
+}
+
+/*
+Crons are planned as the expressions that are added and
+removed, not as the whole list.
+*/
+func TestCronChangesArePlanned(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "build"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "build", "_core.base.api.index.js"), []byte("export default {};"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withCrons := func(crons ...interface{}) map[string][]*exportedConfig {
+		return map[string][]*exportedConfig{
+			dir: {
+				{ExportName: "coreBaseApi", Config: config{"type": "cloudflare-worker", "name": "CORE_BASE_API", "crons": crons}},
+			},
+		}
+	}
+
+	upJsonPath := newTestUpJsonPath(t, "{}")
+	deployTestResources(t, newTestResources(t, upJsonPath, withCrons("0 * * * *", "30 * * * *")), map[string]interface{}{
+		"CORE_BASE_API": &CloudflareWorkerOutput{ScriptName: "project-core-base-api", ModuleHash: hashCloudflareWorkerModule("export default {};")},
+	})
+
+	r := newTestResources(t, upJsonPath, withCrons("30 * * * *", "0 0 * * *"))
+	if state := r.nameToState["CORE_BASE_API"]; state != stateType(UPDATED) {
+		t.Fatalf("got %s, expected UPDATED", state)
+	}
+	if r.shouldReplace("CORE_BASE_API") {
+		t.Error("expected the worker's crons to be updated in place")
+	}
+
+	output := captureStdout(t, func() {
+		r.logNameConfigChanges("CORE_BASE_API")
+	})
+
+	expected := []string{"  + crons: 0 0 * * *", "  - crons: 0 * * * *"}
+	result := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %q, expected %q", result, expected)
+	}
+}
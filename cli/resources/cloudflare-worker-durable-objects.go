@@ -0,0 +1,215 @@
+package resources
+
+import (
+	"fmt"
+	"gas/helpers"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+/*
+Classes are the Durable Object classes the worker exports.
+Bindings reference a class by name, either one of the
+worker's own classes or, if worker is set, a class exported
+by another worker resource (by config name) it depends on.
+
+Deleting a class deletes all of its objects' data, so a class
+can only be removed from classes if it's also listed in
+allowDeletedClasses.
+*/
+type CloudflareWorkerDurableObjects struct {
+	Classes []struct {
+		ClassName   string `json:"className"`
+		RenamedFrom string `json:"renamedFrom,omitempty"`
+	} `json:"classes,omitempty"`
+	Bindings []struct {
+		Binding   string `json:"binding"`
+		ClassName string `json:"className"`
+		Worker    string `json:"worker,omitempty"`
+	} `json:"bindings,omitempty"`
+	AllowDeletedClasses []string `json:"allowDeletedClasses,omitempty"`
+}
+
+func (c *CloudflareWorkerConfig) durableObjectClassNames() []string {
+	if c.DurableObjects == nil {
+		return nil
+	}
+	result := make([]string, 0, len(c.DurableObjects.Classes))
+	for _, class := range c.DurableObjects.Classes {
+		result = append(result, class.ClassName)
+	}
+	return result
+}
+
+/*
+Bindings to the worker's own classes have no worker.
+*/
+func cloudflareWorkerDurableObjectRefs(config interface{}) []string {
+	c := config.(*CloudflareWorkerConfig)
+	result := make([]string, 0)
+	if c.DurableObjects == nil {
+		return result
+	}
+	for _, binding := range c.DurableObjects.Bindings {
+		result = append(result, binding.Worker)
+	}
+	return result
+}
+
+func setCloudflareWorkerDurableObjectBindings(p *processorParams, c *CloudflareWorkerConfig, bindings cloudflareWorkerBindings) error {
+	if c.DurableObjects == nil {
+		return nil
+	}
+	for _, binding := range c.DurableObjects.Bindings {
+		if binding.Worker == "" {
+			if !helpers.IsStringInSlice(c.durableObjectClassNames(), binding.ClassName) {
+				return fmt.Errorf("unable to bind %s to Durable Object class %s, it's not one of %s's classes", binding.Binding, binding.ClassName, c.Name)
+			}
+			bindings[binding.Binding] = cloudflare.WorkerDurableObjectBinding{
+				ClassName: binding.ClassName,
+			}
+			continue
+		}
+
+		scriptName, err := cloudflareWorkerScriptNameByConfigName(p, binding.Worker)
+		if err != nil {
+			return err
+		}
+		bindings[binding.Binding] = cloudflare.WorkerDurableObjectBinding{
+			ClassName:  binding.ClassName,
+			ScriptName: scriptName,
+		}
+	}
+	return nil
+}
+
+type cloudflareWorkerRenamedClass struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+/*
+A migration moves a worker's Durable Object classes from
+the ones in its up output to the ones in its config. Its
+tags make Cloudflare reject it if the script's current tag
+isn't the one the up output says it is.
+*/
+type cloudflareWorkerMigration struct {
+	OldTag         string                         `json:"old_tag,omitempty"`
+	NewTag         string                         `json:"new_tag"`
+	NewClasses     []string                       `json:"new_classes,omitempty"`
+	RenamedClasses []cloudflareWorkerRenamedClass `json:"renamed_classes,omitempty"`
+	DeletedClasses []string                       `json:"deleted_classes,omitempty"`
+}
+
+/*
+Classes are matched by name. A class that isn't in the up
+output is renamed if its renamedFrom class is, otherwise it's
+new. renamedFrom can be left in config after the rename is
+deployed because the class is then in the up output.
+*/
+func newCloudflareWorkerMigration(c *CloudflareWorkerConfig, uo *CloudflareWorkerOutput) (*cloudflareWorkerMigration, error) {
+	result := &cloudflareWorkerMigration{}
+
+	upClasses := make([]string, 0)
+	if uo != nil {
+		result.OldTag = uo.MigrationTag
+		upClasses = uo.DurableObjectClasses
+	}
+
+	newTag, err := nextCloudflareWorkerMigrationTag(result.OldTag)
+	if err != nil {
+		return result, err
+	}
+	result.NewTag = newTag
+
+	classes := c.durableObjectClassNames()
+	renamedFrom := make([]string, 0)
+
+	if c.DurableObjects != nil {
+		for _, class := range c.DurableObjects.Classes {
+			if helpers.IsStringInSlice(upClasses, class.ClassName) {
+				continue
+			}
+
+			if class.RenamedFrom != "" && helpers.IsStringInSlice(upClasses, class.RenamedFrom) {
+				if helpers.IsStringInSlice(classes, class.RenamedFrom) {
+					return result, fmt.Errorf("unable to rename Durable Object class %s to %s, %s is still one of %s's classes", class.RenamedFrom, class.ClassName, class.RenamedFrom, c.Name)
+				}
+				result.RenamedClasses = append(result.RenamedClasses, cloudflareWorkerRenamedClass{
+					From: class.RenamedFrom,
+					To:   class.ClassName,
+				})
+				renamedFrom = append(renamedFrom, class.RenamedFrom)
+				continue
+			}
+
+			result.NewClasses = append(result.NewClasses, class.ClassName)
+		}
+	}
+
+	allowDeletedClasses := make([]string, 0)
+	if c.DurableObjects != nil {
+		allowDeletedClasses = c.DurableObjects.AllowDeletedClasses
+	}
+
+	for _, upClass := range upClasses {
+		if helpers.IsStringInSlice(classes, upClass) || helpers.IsStringInSlice(renamedFrom, upClass) {
+			continue
+		}
+		result.DeletedClasses = append(result.DeletedClasses, upClass)
+	}
+
+	for _, deletedClass := range result.DeletedClasses {
+		if !helpers.IsStringInSlice(allowDeletedClasses, deletedClass) {
+			return result, fmt.Errorf("unable to delete Durable Object class %s of %s without deleting its data, add it to durableObjects.allowDeletedClasses to allow it", deletedClass, c.Name)
+		}
+	}
+
+	return result, nil
+}
+
+/*
+Tags are v1, v2, etc.
+*/
+func nextCloudflareWorkerMigrationTag(tag string) (string, error) {
+	if tag == "" {
+		return "v1", nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(tag, "v"))
+	if err != nil {
+		return "", fmt.Errorf("unable to parse Durable Object migration tag %s\n%v", tag, err)
+	}
+	return "v" + strconv.Itoa(n+1), nil
+}
+
+func (m *cloudflareWorkerMigration) isEmpty() bool {
+	return len(m.NewClasses) == 0 && len(m.RenamedClasses) == 0 && len(m.DeletedClasses) == 0
+}
+
+/*
+The tag the script has after the migration is applied, which
+is the old tag if there's nothing to migrate.
+*/
+func (m *cloudflareWorkerMigration) tag() string {
+	if m.isEmpty() {
+		return m.OldTag
+	}
+	return m.NewTag
+}
+
+func (m *cloudflareWorkerMigration) describe() []string {
+	result := make([]string, 0)
+	for _, class := range m.NewClasses {
+		result = append(result, "durable object class "+class+" (new)")
+	}
+	for _, class := range m.RenamedClasses {
+		result = append(result, "durable object class "+class.From+" -> "+class.To+" (renamed)")
+	}
+	for _, class := range m.DeletedClasses {
+		result = append(result, "durable object class "+class+" (deleted)")
+	}
+	return result
+}
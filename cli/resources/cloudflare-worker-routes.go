@@ -0,0 +1,314 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+/*
+Routes and domains reference the cloudflare-dns-zone
+resource they belong to by config name.
+*/
+type CloudflareWorkerRoute struct {
+	Zone    string `json:"zone"`
+	Pattern string `json:"pattern"`
+}
+
+type CloudflareWorkerDomain struct {
+	Zone     string `json:"zone"`
+	Hostname string `json:"hostname"`
+}
+
+type CloudflareWorkerRouteOutput struct {
+	ID      string `json:"id"`
+	ZoneID  string `json:"zoneId"`
+	Pattern string `json:"pattern"`
+}
+
+type CloudflareWorkerDomainOutput struct {
+	ID       string `json:"id"`
+	Hostname string `json:"hostname"`
+}
+
+func init() {
+	registerPermissions("cloudflare-worker", func(config interface{}, state stateType) []string {
+		c := config.(*CloudflareWorkerConfig)
+		if len(c.Routes) > 0 || len(c.Domains) > 0 {
+			return []string{"Workers Routes Write"}
+		}
+		return nil
+	})
+
+	registerCloudflareWorkerSubresource(&cloudflareWorkerSubresource{
+		put:    putCloudflareWorkerRoutes,
+		remove: removeCloudflareWorkerRoutes,
+	})
+
+	registerConfigRefs("cloudflare-worker", func(config interface{}) []string {
+		c := config.(*CloudflareWorkerConfig)
+		result := make([]string, 0, len(c.Routes)+len(c.Domains))
+		for _, route := range c.Routes {
+			result = append(result, route.Zone)
+		}
+		for _, domain := range c.Domains {
+			result = append(result, domain.Zone)
+		}
+		return result
+	})
+}
+
+/*
+Routes are diffed against the up output by zone and pattern.
+A new route whose pattern already exists in its zone (e.g.
+because the worker is being replaced) is pointed at the
+worker instead of created, since patterns are unique.
+*/
+func putCloudflareWorkerRoutes(api *cloudflareClient, p *processorParams, output *CloudflareWorkerOutput) error {
+	c := p.config.(*CloudflareWorkerConfig)
+	uo, _ := p.upOutput.(*CloudflareWorkerOutput)
+
+	upRoutes := make([]CloudflareWorkerRouteOutput, 0)
+	upDomains := make([]CloudflareWorkerDomainOutput, 0)
+	if uo != nil {
+		upRoutes = append(upRoutes, uo.Routes...)
+		upDomains = append(upDomains, uo.Domains...)
+	}
+
+	for _, route := range c.Routes {
+		zoneID, err := cloudflareDnsZoneID(p, route.Zone)
+		if err != nil {
+			return err
+		}
+
+		routeOutput, ok := findCloudflareWorkerRouteOutput(upRoutes, zoneID, route.Pattern)
+		if !ok {
+			routeOutput, err = putCloudflareWorkerRoute(api, zoneID, route.Pattern, output.ScriptName)
+			if err != nil {
+				return err
+			}
+		}
+
+		output.Routes = append(output.Routes, routeOutput)
+	}
+
+	for _, upRoute := range upRoutes {
+		if _, ok := findCloudflareWorkerRouteOutput(output.Routes, upRoute.ZoneID, upRoute.Pattern); !ok {
+			err := removeCloudflareWorkerRoute(api, upRoute, uo.ScriptName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, domain := range c.Domains {
+		domainOutput, ok := findCloudflareWorkerDomainOutput(upDomains, domain.Hostname)
+		if !ok {
+			zoneID, err := cloudflareDnsZoneID(p, domain.Zone)
+			if err != nil {
+				return err
+			}
+
+			res, err := api.AttachWorkersDomain(context.Background(), api.account, cloudflare.AttachWorkersDomainParams{
+				ZoneID:      zoneID,
+				Hostname:    domain.Hostname,
+				Service:     output.ScriptName,
+				Environment: "production",
+			})
+			if err != nil {
+				return fmt.Errorf("unable to attach domain %s to %s\n%v", domain.Hostname, output.ScriptName, err)
+			}
+
+			domainOutput = CloudflareWorkerDomainOutput{
+				ID:       res.ID,
+				Hostname: res.Hostname,
+			}
+		}
+
+		output.Domains = append(output.Domains, domainOutput)
+	}
+
+	for _, upDomain := range upDomains {
+		if _, ok := findCloudflareWorkerDomainOutput(output.Domains, upDomain.Hostname); !ok {
+			err := removeCloudflareWorkerDomain(api, upDomain, uo.ScriptName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// workers.dev is left as is if it isn't configured.
+	if c.WorkersDev != nil {
+		_, err := api.Raw(
+			context.Background(),
+			http.MethodPost,
+			fmt.Sprintf("/accounts/%s/workers/scripts/%s/subdomain", api.account.Identifier, output.ScriptName),
+			map[string]interface{}{
+				"enabled": *c.WorkersDev,
+			},
+			nil,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to set workers.dev of %s\n%v", output.ScriptName, err)
+		}
+	}
+
+	return setCloudflareWorkerURLs(api, c, output)
+}
+
+func findCloudflareWorkerRouteOutput(routes []CloudflareWorkerRouteOutput, zoneID string, pattern string) (CloudflareWorkerRouteOutput, bool) {
+	for _, route := range routes {
+		if route.ZoneID == zoneID && route.Pattern == pattern {
+			return route, true
+		}
+	}
+	return CloudflareWorkerRouteOutput{}, false
+}
+
+func findCloudflareWorkerDomainOutput(domains []CloudflareWorkerDomainOutput, hostname string) (CloudflareWorkerDomainOutput, bool) {
+	for _, domain := range domains {
+		if domain.Hostname == hostname {
+			return domain, true
+		}
+	}
+	return CloudflareWorkerDomainOutput{}, false
+}
+
+func putCloudflareWorkerRoute(api *cloudflareClient, zoneID string, pattern string, scriptName string) (CloudflareWorkerRouteOutput, error) {
+	result := CloudflareWorkerRouteOutput{
+		ZoneID:  zoneID,
+		Pattern: pattern,
+	}
+
+	zone := cloudflare.ZoneIdentifier(zoneID)
+
+	res, err := api.ListWorkerRoutes(context.Background(), zone, cloudflare.ListWorkerRoutesParams{})
+	if err != nil {
+		return result, fmt.Errorf("unable to list routes of zone %s\n%v", zoneID, err)
+	}
+
+	for _, route := range res.Routes {
+		if route.Pattern == pattern {
+			_, err = api.UpdateWorkerRoute(context.Background(), zone, cloudflare.UpdateWorkerRouteParams{
+				ID:      route.ID,
+				Pattern: pattern,
+				Script:  scriptName,
+			})
+			if err != nil {
+				return result, fmt.Errorf("unable to update route %s\n%v", pattern, err)
+			}
+			result.ID = route.ID
+			return result, nil
+		}
+	}
+
+	created, err := api.CreateWorkerRoute(context.Background(), zone, cloudflare.CreateWorkerRouteParams{
+		Pattern: pattern,
+		Script:  scriptName,
+	})
+	if err != nil {
+		return result, fmt.Errorf("unable to create route %s\n%v", pattern, err)
+	}
+	result.ID = created.ID
+
+	return result, nil
+}
+
+/*
+A route or domain is only removed if it still belongs to the
+worker. A replacement worker may have taken it over.
+*/
+func removeCloudflareWorkerRoute(api *cloudflareClient, route CloudflareWorkerRouteOutput, scriptName string) error {
+	zone := cloudflare.ZoneIdentifier(route.ZoneID)
+
+	res, err := api.GetWorkerRoute(context.Background(), zone, route.ID)
+	if err != nil {
+		var notFoundErr *cloudflare.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return nil
+		}
+		return fmt.Errorf("unable to get route %s\n%v", route.Pattern, err)
+	}
+
+	if res.ScriptName != scriptName {
+		return nil
+	}
+
+	_, err = api.DeleteWorkerRoute(context.Background(), zone, route.ID)
+	if err != nil {
+		return fmt.Errorf("unable to remove route %s\n%v", route.Pattern, err)
+	}
+
+	return nil
+}
+
+func removeCloudflareWorkerDomain(api *cloudflareClient, domain CloudflareWorkerDomainOutput, scriptName string) error {
+	res, err := api.GetWorkersDomain(context.Background(), api.account, domain.ID)
+	if err != nil {
+		var notFoundErr *cloudflare.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return nil
+		}
+		return fmt.Errorf("unable to get domain %s\n%v", domain.Hostname, err)
+	}
+
+	if res.Service != scriptName {
+		return nil
+	}
+
+	err = api.DetachWorkersDomain(context.Background(), api.account, domain.ID)
+	if err != nil {
+		return fmt.Errorf("unable to detach domain %s\n%v", domain.Hostname, err)
+	}
+
+	return nil
+}
+
+func removeCloudflareWorkerRoutes(api *cloudflareClient, p *processorParams, upOutput *CloudflareWorkerOutput) error {
+	for _, route := range upOutput.Routes {
+		err := removeCloudflareWorkerRoute(api, route, upOutput.ScriptName)
+		if err != nil {
+			return err
+		}
+	}
+	for _, domain := range upOutput.Domains {
+		err := removeCloudflareWorkerDomain(api, domain, upOutput.ScriptName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+URLs are the worker's domains, routes without a wildcard
+host (api.example.com/* -> https://api.example.com/), and
+its workers.dev URL if it's enabled.
+*/
+func setCloudflareWorkerURLs(api *cloudflareClient, c *CloudflareWorkerConfig, output *CloudflareWorkerOutput) error {
+	output.URLs = nil
+
+	for _, domain := range output.Domains {
+		output.URLs = append(output.URLs, "https://"+domain.Hostname)
+	}
+
+	for _, route := range output.Routes {
+		if !strings.HasPrefix(route.Pattern, "*") {
+			output.URLs = append(output.URLs, "https://"+strings.TrimSuffix(route.Pattern, "*"))
+		}
+	}
+
+	if c.WorkersDev != nil && *c.WorkersDev {
+		subdomain, err := api.WorkersGetSubdomain(context.Background(), api.account)
+		if err != nil {
+			return fmt.Errorf("unable to get workers.dev subdomain\n%v", err)
+		}
+		output.URLs = append(output.URLs, fmt.Sprintf("https://%s.%s.workers.dev", output.ScriptName, subdomain.Name))
+	}
+
+	return nil
+}
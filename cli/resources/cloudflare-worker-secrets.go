@@ -0,0 +1,166 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"gas/secrets"
+	"sort"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	registerPendingChanges("cloudflare-worker", func(dir string, config interface{}, upOutput interface{}) ([]string, error) {
+		changes, err := newCloudflareWorkerSecretChanges(config.(*CloudflareWorkerConfig).Name, upOutput.(*CloudflareWorkerOutput))
+		if err != nil {
+			return nil, err
+		}
+		return changes.describe(), nil
+	})
+
+	registerCloudflareWorkerBindings(setCloudflareWorkerSecretBindings)
+
+	registerCloudflareWorkerSubresource(&cloudflareWorkerSubresource{
+		put:    putCloudflareWorkerSecrets,
+		remove: removeCloudflareWorkerSecrets,
+	})
+}
+
+/*
+Secret changes are worked out by comparing the hashes of a
+worker's secrets in the secrets store (see gas secrets) with
+the hashes in its up output. Values are never part of state
+or logs.
+*/
+type cloudflareWorkerSecretChanges struct {
+	values  map[string]string
+	hashes  map[string]string
+	changed []string
+	removed []string
+	isNew   map[string]bool
+}
+
+func newCloudflareWorkerSecretChanges(name string, uo *CloudflareWorkerOutput) (*cloudflareWorkerSecretChanges, error) {
+	store, err := secrets.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := store.Values(viper.GetString("stage"), name)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes, err := store.Hashes(values)
+	if err != nil {
+		return nil, err
+	}
+
+	upHashes := make(map[string]string)
+	if uo != nil && uo.SecretHashes != nil {
+		upHashes = uo.SecretHashes
+	}
+
+	result := &cloudflareWorkerSecretChanges{
+		values:  values,
+		hashes:  hashes,
+		changed: make([]string, 0),
+		removed: make([]string, 0),
+		isNew:   make(map[string]bool),
+	}
+
+	for key, hash := range hashes {
+		upHash, ok := upHashes[key]
+		if !ok {
+			result.isNew[key] = true
+		}
+		if hash != upHash {
+			result.changed = append(result.changed, key)
+		}
+	}
+
+	for key := range upHashes {
+		if _, ok := hashes[key]; !ok {
+			result.removed = append(result.removed, key)
+		}
+	}
+
+	sort.Strings(result.changed)
+	sort.Strings(result.removed)
+
+	return result, nil
+}
+
+func (c *cloudflareWorkerSecretChanges) describe() []string {
+	result := make([]string, 0)
+	for _, key := range c.changed {
+		if c.isNew[key] {
+			result = append(result, "secret "+key+" (new)")
+		} else {
+			result = append(result, "secret "+key+" (changed)")
+		}
+	}
+	for _, key := range c.removed {
+		result = append(result, "secret "+key+" (removed)")
+	}
+	return result
+}
+
+/*
+Changed secrets are uploaded as bindings with the script so
+they're live as soon as it is. Unchanged secrets are kept by
+the upload (see cloudflareWorkerMetadata.KeepBindings).
+*/
+func setCloudflareWorkerSecretBindings(p *processorParams, c *CloudflareWorkerConfig, bindings cloudflareWorkerBindings) error {
+	uo, _ := p.upOutput.(*CloudflareWorkerOutput)
+
+	changes, err := newCloudflareWorkerSecretChanges(c.Name, uo)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range changes.changed {
+		bindings[key] = cloudflare.WorkerSecretTextBinding{
+			Text: changes.values[key],
+		}
+	}
+
+	return nil
+}
+
+/*
+Removed secrets are kept by the upload, so they're deleted
+after it.
+*/
+func putCloudflareWorkerSecrets(api *cloudflareClient, p *processorParams, output *CloudflareWorkerOutput) error {
+	uo, _ := p.upOutput.(*CloudflareWorkerOutput)
+
+	changes, err := newCloudflareWorkerSecretChanges(p.config.(*CloudflareWorkerConfig).Name, uo)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range changes.removed {
+		_, err := api.DeleteWorkersSecret(context.Background(), api.account, cloudflare.DeleteWorkersSecretParams{
+			ScriptName: output.ScriptName,
+			SecretName: key,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to remove secret %s of %s\n%v", key, output.ScriptName, err)
+		}
+	}
+
+	if len(changes.hashes) > 0 {
+		output.SecretHashes = changes.hashes
+	}
+
+	return nil
+}
+
+/*
+Secrets are deleted with their script.
+*/
+func removeCloudflareWorkerSecrets(api *cloudflareClient, p *processorParams, upOutput *CloudflareWorkerOutput) error {
+	return nil
+}
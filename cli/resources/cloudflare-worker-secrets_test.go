@@ -0,0 +1,128 @@
+package resources
+
+import (
+	"encoding/base64"
+	"gas/secrets"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCloudflareWorkerSecretChanges(t *testing.T) {
+	t.Setenv("GAS_SECRETS_KEY", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+	t.Setenv("TEST_STRIPE_KEY", "sk_test")
+	viper.Set("stage", "dev")
+	t.Cleanup(func() {
+		viper.Set("stage", nil)
+		viper.Set("secretsJsonPath", nil)
+	})
+
+	tests := []struct {
+		name     string
+		values   map[string]string
+		envs     map[string]string
+		upValues map[string]string
+		expected []string
+	}{
+		{
+			name:     "no secrets",
+			expected: []string{},
+		},
+		{
+			name:     "new secret",
+			values:   map[string]string{"API_KEY": "key"},
+			expected: []string{"secret API_KEY (new)"},
+		},
+		{
+			name:     "unchanged secret",
+			values:   map[string]string{"API_KEY": "key"},
+			upValues: map[string]string{"API_KEY": "key"},
+			expected: []string{},
+		},
+		{
+			name:     "changed secret",
+			values:   map[string]string{"API_KEY": "new key"},
+			upValues: map[string]string{"API_KEY": "key"},
+			expected: []string{"secret API_KEY (changed)"},
+		},
+		{
+			name:     "removed secret",
+			upValues: map[string]string{"API_KEY": "key"},
+			expected: []string{"secret API_KEY (removed)"},
+		},
+		{
+			name:     "unchanged secret read from env var",
+			envs:     map[string]string{"STRIPE_KEY": "TEST_STRIPE_KEY"},
+			upValues: map[string]string{"STRIPE_KEY": "sk_test"},
+			expected: []string{},
+		},
+		{
+			name:     "several changes",
+			values:   map[string]string{"B_KEY": "b", "A_KEY": "new a"},
+			upValues: map[string]string{"A_KEY": "a", "C_KEY": "c"},
+			expected: []string{"secret A_KEY (changed)", "secret B_KEY (new)", "secret C_KEY (removed)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("secretsJsonPath", filepath.Join(t.TempDir(), "gas.secrets.json"))
+
+			store, err := secrets.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range tt.values {
+				err = store.Set("dev", "CORE_BASE_API", key, value)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for key, env := range tt.envs {
+				store.SetFromEnv("dev", "CORE_BASE_API", key, env)
+			}
+			err = store.Save()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			upHashes, err := store.Hashes(tt.upValues)
+			if err != nil {
+				t.Fatal(err)
+			}
+			uo := &CloudflareWorkerOutput{ScriptName: "project-core-base-api", SecretHashes: upHashes}
+
+			changes, err := newCloudflareWorkerSecretChanges("CORE_BASE_API", uo)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := changes.describe()
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("got %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+
+	t.Run("unset env var", func(t *testing.T) {
+		viper.Set("secretsJsonPath", filepath.Join(t.TempDir(), "gas.secrets.json"))
+
+		store, err := secrets.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.SetFromEnv("dev", "CORE_BASE_API", "MISSING_KEY", "TEST_MISSING_KEY")
+		err = store.Save()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = newCloudflareWorkerSecretChanges("CORE_BASE_API", &CloudflareWorkerOutput{})
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package resources
+
+import (
+	"fmt"
+	"gas/helpers"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+func init() {
+	registerStageConfig("cloudflare-worker", applyCloudflareWorkerStageVars)
+
+	registerValidator("cloudflare-worker", validateCloudflareWorkerRuntimeBindingNames)
+
+	registerCloudflareWorkerBindings(setCloudflareWorkerVarBindings)
+	registerCloudflareWorkerBindings(setCloudflareWorkerRuntimeBindings)
+}
+
+/*
+A stage's vars override (or add to) the vars in a worker's
+config. They're merged into the config so they're part of
+its diff.
+*/
+func applyCloudflareWorkerStageVars(config interface{}, stage *stageConfig) error {
+	c := config.(*CloudflareWorkerConfig)
+
+	vars, ok := stage.Vars[c.Name]
+	if !ok {
+		return nil
+	}
+
+	if c.Vars == nil {
+		c.Vars = make(map[string]string)
+	}
+	for key, value := range vars {
+		c.Vars[key] = value
+	}
+
+	return nil
+}
+
+/*
+Vars and runtime bindings share the worker's env, so their
+names can't overlap.
+*/
+func validateCloudflareWorkerRuntimeBindingNames(config interface{}) error {
+	c := config.(*CloudflareWorkerConfig)
+
+	names := make([]string, 0)
+	for key := range c.Vars {
+		names = append(names, key)
+	}
+
+	runtimeNames := make([]string, 0)
+	if c.AI != nil {
+		runtimeNames = append(runtimeNames, c.AI.Binding)
+	}
+	for _, dataset := range c.AnalyticsEngineDatasets {
+		runtimeNames = append(runtimeNames, dataset.Binding)
+	}
+	if c.Browser != nil {
+		runtimeNames = append(runtimeNames, c.Browser.Binding)
+	}
+	if c.VersionMetadata != nil {
+		runtimeNames = append(runtimeNames, c.VersionMetadata.Binding)
+	}
+
+	for _, name := range runtimeNames {
+		if name == "" {
+			return fmt.Errorf("runtime bindings require a binding name")
+		}
+		if helpers.IsStringInSlice(names, name) {
+			return fmt.Errorf("binding %s is defined more than once", name)
+		}
+		names = append(names, name)
+	}
+
+	return nil
+}
+
+func setCloudflareWorkerVarBindings(p *processorParams, c *CloudflareWorkerConfig, bindings cloudflareWorkerBindings) error {
+	for key, value := range c.Vars {
+		bindings[key] = cloudflare.WorkerPlainTextBinding{
+			Text: value,
+		}
+	}
+	return nil
+}
+
+/*
+Runtime bindings have no gas resource behind them.
+cloudflare-go only has a type for Analytics Engine, so the
+rest are uploaded as raw bindings.
+*/
+func setCloudflareWorkerRuntimeBindings(p *processorParams, c *CloudflareWorkerConfig, bindings cloudflareWorkerBindings) error {
+	if c.AI != nil {
+		bindings[c.AI.Binding] = cloudflare.UnsafeBinding{
+			"type": "ai",
+		}
+	}
+
+	for _, dataset := range c.AnalyticsEngineDatasets {
+		// Datasets default to the binding name like in wrangler.
+		name := dataset.Dataset
+		if name == "" {
+			name = dataset.Binding
+		}
+		bindings[dataset.Binding] = cloudflare.WorkerAnalyticsEngineBinding{
+			Dataset: name,
+		}
+	}
+
+	if c.Browser != nil {
+		bindings[c.Browser.Binding] = cloudflare.UnsafeBinding{
+			"type": "browser",
+		}
+	}
+
+	if c.VersionMetadata != nil {
+		bindings[c.VersionMetadata.Binding] = cloudflare.UnsafeBinding{
+			"type": "version_metadata",
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,590 @@
+package resources
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gas/helpers"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+const (
+	CLOUDFLARE_WORKER_CREATED processorKeyType = "cloudflare-worker:CREATED"
+	CLOUDFLARE_WORKER_DELETED processorKeyType = "cloudflare-worker:DELETED"
+	CLOUDFLARE_WORKER_UPDATED processorKeyType = "cloudflare-worker:UPDATED"
+)
+
+type CloudflareWorkerConfig struct {
+	ConfigCommon
+	AI *struct {
+		Binding string `json:"binding"`
+	} `json:"ai,omitempty"`
+	AnalyticsEngineDatasets []struct {
+		Binding string `json:"binding"`
+		Dataset string `json:"dataset,omitempty"`
+	} `json:"analyticsEngineDatasets,omitempty"`
+	Browser *struct {
+		Binding string `json:"binding"`
+	} `json:"browser,omitempty"`
+	CompatibilityDate  string   `json:"compatibilityDate,omitempty" schema:"pattern=^\\d{4}-\\d{2}-\\d{2}$"`
+	CompatibilityFlags []string `json:"compatibilityFlags,omitempty"`
+	Crons              []string `json:"crons,omitempty"`
+	D1                 []struct {
+		Binding string `json:"binding"`
+	} `json:"d1,omitempty"`
+	Domains        []CloudflareWorkerDomain        `json:"domains,omitempty"`
+	DurableObjects *CloudflareWorkerDurableObjects `json:"durableObjects,omitempty"`
+	Hyperdrive     []struct {
+		Binding string `json:"binding"`
+	} `json:"hyperdrive,omitempty"`
+	KV []struct {
+		Binding string `json:"binding"`
+	} `json:"kv,omitempty"`
+	Queues *CloudflareWorkerQueues `json:"queues,omitempty"`
+	R2     []struct {
+		Binding string `json:"binding"`
+	} `json:"r2,omitempty"`
+	Routes   []CloudflareWorkerRoute `json:"routes,omitempty"`
+	Services []struct {
+		Binding string `json:"binding"`
+	} `json:"services,omitempty"`
+	Vars      map[string]string `json:"vars,omitempty"`
+	Vectorize []struct {
+		Binding string `json:"binding"`
+	} `json:"vectorize,omitempty"`
+	VersionMetadata *struct {
+		Binding string `json:"binding"`
+	} `json:"versionMetadata,omitempty"`
+	WorkersDev *bool `json:"workersDev,omitempty"`
+}
+
+/*
+Producers are bindings to queues the worker sends messages
+to. Consumers are queues the worker receives batches from.
+Both reference the queue resource by config name.
+*/
+type CloudflareWorkerQueues struct {
+	Producers []struct {
+		Binding string `json:"binding"`
+	} `json:"producers,omitempty"`
+	Consumers []CloudflareWorkerQueueConsumer `json:"consumers,omitempty"`
+}
+
+type CloudflareWorkerQueueConsumer struct {
+	Queue           string `json:"queue"`
+	MaxBatchSize    int    `json:"maxBatchSize,omitempty"`
+	MaxRetries      int    `json:"maxRetries,omitempty"`
+	MaxWaitTimeMs   int    `json:"maxWaitTimeMs,omitempty"`
+	DeadLetterQueue string `json:"deadLetterQueue,omitempty"`
+}
+
+type CloudflareWorkerOutput struct {
+	ScriptName           string                         `json:"scriptName"`
+	ModuleHash           string                         `json:"moduleHash,omitempty"`
+	MigrationTag         string                         `json:"migrationTag,omitempty"`
+	DurableObjectClasses []string                       `json:"durableObjectClasses,omitempty"`
+	SecretHashes         map[string]string              `json:"secretHashes,omitempty"`
+	Routes               []CloudflareWorkerRouteOutput  `json:"routes,omitempty"`
+	Domains              []CloudflareWorkerDomainOutput `json:"domains,omitempty"`
+	URLs                 []string                       `json:"urls,omitempty"`
+	QueueConsumers       []string                       `json:"queueConsumers,omitempty"`
+}
+
+func init() {
+	registerConfig("cloudflare-worker", func(config config) interface{} {
+		return decodeConfig(config, &CloudflareWorkerConfig{})
+	})
+
+	registerUpOutput("cloudflare-worker", func(output upOutput) interface{} {
+		return decodeUpOutput(output, &CloudflareWorkerOutput{})
+	})
+
+	registerDeployOutput(CLOUDFLARE_WORKER_CREATED, func(res interface{}) interface{} {
+		return res.(*CloudflareWorkerOutput)
+	})
+
+	registerDeployOutput(CLOUDFLARE_WORKER_UPDATED, func(res interface{}) interface{} {
+		return res.(*CloudflareWorkerOutput)
+	})
+
+	// The script name is derived from the config name, and
+	// Cloudflare can't rename scripts.
+	registerReplaceFields("cloudflare-worker", "name")
+
+	registerPermissions("cloudflare-worker", func(config interface{}, state stateType) []string {
+		return []string{"Workers Scripts Write"}
+	})
+
+	registerProcessor(CLOUDFLARE_WORKER_CREATED, processCloudflareWorkerCreated)
+	registerProcessor(CLOUDFLARE_WORKER_DELETED, processCloudflareWorkerDeleted)
+	registerProcessor(CLOUDFLARE_WORKER_UPDATED, processCloudflareWorkerUpdated)
+
+	registerPendingChanges("cloudflare-worker", func(dir string, config interface{}, upOutput interface{}) ([]string, error) {
+		migration, err := newCloudflareWorkerMigration(config.(*CloudflareWorkerConfig), upOutput.(*CloudflareWorkerOutput))
+		if err != nil {
+			return nil, err
+		}
+		return migration.describe(), nil
+	})
+
+	registerPendingChanges("cloudflare-worker", cloudflareWorkerModuleChanges)
+
+	registerDeferrableDep("cloudflare-worker", isCloudflareWorkerServiceBindingDep)
+
+	registerCloudflareWorkerBindings(setCloudflareWorkerDurableObjectBindings)
+	registerCloudflareWorkerBindings(setCloudflareWorkerKvBindings)
+	registerCloudflareWorkerBindings(setCloudflareWorkerServiceBindings)
+
+	registerConfigRefs("cloudflare-worker", cloudflareWorkerDurableObjectRefs)
+	registerConfigRefs("cloudflare-worker", cloudflareWorkerKvRefs)
+	registerConfigRefs("cloudflare-worker", cloudflareWorkerServiceRefs)
+}
+
+/*
+Worker script names are the only thing dependents need to
+bind to a worker (see setCloudflareWorkerServiceBindings).
+*/
+func cloudflareWorkerScriptNameByConfigName(p *processorParams, binding string) (string, error) {
+	output, err := p.depOutputByConfigName("cloudflare-worker", binding)
+	if err != nil {
+		return "", err
+	}
+	return output.(*CloudflareWorkerOutput).ScriptName, nil
+}
+
+type cloudflareWorkerBindings = map[string]cloudflare.WorkerBinding
+
+/*
+Binding setters add a worker's bindings of one kind to its
+bindings map. Resource types that can be bound to a worker
+register a setter so the worker provider doesn't need to
+know about them.
+*/
+type cloudflareWorkerBindingSetter func(
+	p *processorParams,
+	c *CloudflareWorkerConfig,
+	bindings cloudflareWorkerBindings,
+) error
+
+var cloudflareWorkerBindingSetters []cloudflareWorkerBindingSetter
+
+func registerCloudflareWorkerBindings(setter cloudflareWorkerBindingSetter) {
+	cloudflareWorkerBindingSetters = append(cloudflareWorkerBindingSetters, setter)
+}
+
+func cloudflareWorkerKvRefs(config interface{}) []string {
+	result := make([]string, 0)
+	for _, kv := range config.(*CloudflareWorkerConfig).KV {
+		result = append(result, kv.Binding)
+	}
+	return result
+}
+
+func setCloudflareWorkerKvBindings(p *processorParams, c *CloudflareWorkerConfig, bindings cloudflareWorkerBindings) error {
+	for _, kv := range c.KV {
+		namespaceID, err := cloudflareKvNamespaceID(p, kv.Binding)
+		if err != nil {
+			return err
+		}
+		bindings[kv.Binding] = cloudflare.WorkerKvNamespaceBinding{
+			NamespaceID: namespaceID,
+		}
+	}
+	return nil
+}
+
+/*
+Workers can call each other (A binds B and B binds A), which
+is a dependency cycle. A dep that's only a service binding
+can be deferred: the worker is uploaded without the binding,
+then again with it once the bound worker exists. Other
+bindings to a worker (e.g. Durable Objects) can't be.
+*/
+func isCloudflareWorkerServiceBindingDep(config interface{}, depConfig interface{}) bool {
+	c := config.(*CloudflareWorkerConfig)
+	d, ok := depConfig.(*CloudflareWorkerConfig)
+	if !ok {
+		return false
+	}
+
+	if c.DurableObjects != nil {
+		for _, binding := range c.DurableObjects.Bindings {
+			if binding.Worker == d.Name {
+				return false
+			}
+		}
+	}
+
+	for _, service := range c.Services {
+		if service.Binding == d.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func cloudflareWorkerServiceRefs(config interface{}) []string {
+	result := make([]string, 0)
+	for _, service := range config.(*CloudflareWorkerConfig).Services {
+		result = append(result, service.Binding)
+	}
+	return result
+}
+
+func setCloudflareWorkerServiceBindings(p *processorParams, c *CloudflareWorkerConfig, bindings cloudflareWorkerBindings) error {
+	for _, service := range c.Services {
+		scriptName, err := cloudflareWorkerScriptNameByConfigName(p, service.Binding)
+		if errors.Is(err, errDeferredDepNotDeployed) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		bindings[service.Binding] = cloudflare.WorkerServiceBinding{
+			Service: scriptName,
+		}
+	}
+	return nil
+}
+
+/*
+Subresources are attached to a worker script after it's
+uploaded (put) and detached before it's deleted (remove).
+Resource types that attach things to workers, such as queue
+consumers, register a subresource so the worker provider
+doesn't need to know about them.
+*/
+type cloudflareWorkerSubresource struct {
+	put    func(api *cloudflareClient, p *processorParams, output *CloudflareWorkerOutput) error
+	remove func(api *cloudflareClient, p *processorParams, upOutput *CloudflareWorkerOutput) error
+}
+
+var cloudflareWorkerSubresources []*cloudflareWorkerSubresource
+
+func registerCloudflareWorkerSubresource(subresource *cloudflareWorkerSubresource) {
+	cloudflareWorkerSubresources = append(cloudflareWorkerSubresources, subresource)
+}
+
+func newCloudflareWorkerBindings(p *processorParams, c *CloudflareWorkerConfig) (cloudflareWorkerBindings, error) {
+	bindings := make(cloudflareWorkerBindings)
+	for _, setter := range cloudflareWorkerBindingSetters {
+		err := setter(p, c, bindings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bindings, nil
+}
+
+/*
+A worker's module is the built index file in its resource
+dir's build dir (e.g. build/_core.base.api.index.js).
+*/
+func readCloudflareWorkerModule(dir string) (string, error) {
+	buildDirPath := filepath.Join(dir, "build")
+
+	indexFilePathPattern := regexp.MustCompile(`^_[^.]+\.[^.]+\.[^.]+\.index\.js$`)
+
+	files, err := os.ReadDir(buildDirPath)
+	if err != nil {
+		return "", fmt.Errorf("unable to read build dir %s\n%v", buildDirPath, err)
+	}
+
+	for _, file := range files {
+		if !file.IsDir() && indexFilePathPattern.MatchString(file.Name()) {
+			data, err := helpers.ReadFile(filepath.Join(buildDirPath, file.Name()))
+			if err != nil {
+				return "", err
+			}
+			return string(data), nil
+		}
+	}
+
+	return "", fmt.Errorf("unable to find resource index.js file in %s", buildDirPath)
+}
+
+/*
+A worker's code isn't part of its config, so the hash of its
+module is kept in its output to tell when the code changed.
+*/
+func hashCloudflareWorkerModule(module string) string {
+	sum := sha256.Sum256([]byte(module))
+	return hex.EncodeToString(sum[:])
+}
+
+func cloudflareWorkerModuleChanges(dir string, config interface{}, upOutput interface{}) ([]string, error) {
+	module, err := readCloudflareWorkerModule(dir)
+	if err != nil {
+		return nil, err
+	}
+	if hashCloudflareWorkerModule(module) != upOutput.(*CloudflareWorkerOutput).ModuleHash {
+		return []string{"module (changed)"}, nil
+	}
+	return nil, nil
+}
+
+/*
+Binding metadata is what the script upload API expects for
+each binding. cloudflare-go only serializes bindings inside
+UploadWorker, which has no way to send Durable Object
+migrations, so scripts are uploaded with putCloudflareWorker.
+*/
+func cloudflareWorkerBindingMetadata(name string, binding cloudflare.WorkerBinding) (map[string]interface{}, error) {
+	result := map[string]interface{}{
+		"name": name,
+		"type": binding.Type(),
+	}
+
+	switch b := binding.(type) {
+	case cloudflare.WorkerAnalyticsEngineBinding:
+		result["dataset"] = b.Dataset
+	case cloudflare.WorkerD1DatabaseBinding:
+		result["id"] = b.DatabaseID
+	case cloudflare.WorkerDurableObjectBinding:
+		result["class_name"] = b.ClassName
+		if b.ScriptName != "" {
+			result["script_name"] = b.ScriptName
+		}
+	case cloudflare.WorkerKvNamespaceBinding:
+		result["namespace_id"] = b.NamespaceID
+	case cloudflare.WorkerPlainTextBinding:
+		result["text"] = b.Text
+	case cloudflare.WorkerQueueBinding:
+		result["queue_name"] = b.Queue
+	case cloudflare.WorkerR2BucketBinding:
+		result["bucket_name"] = b.BucketName
+	case cloudflare.WorkerSecretTextBinding:
+		result["text"] = b.Text
+	case cloudflare.WorkerServiceBinding:
+		result["service"] = b.Service
+	case cloudflare.UnsafeBinding:
+		for key, value := range b {
+			result[key] = value
+		}
+		result["name"] = name
+	default:
+		return nil, fmt.Errorf("unable to upload binding %s of type %s", name, binding.Type())
+	}
+
+	return result, nil
+}
+
+type cloudflareWorkerMetadata struct {
+	MainModule         string                     `json:"main_module"`
+	Bindings           []map[string]interface{}   `json:"bindings"`
+	CompatibilityDate  string                     `json:"compatibility_date,omitempty"`
+	CompatibilityFlags []string                   `json:"compatibility_flags,omitempty"`
+	Migrations         *cloudflareWorkerMigration `json:"migrations,omitempty"`
+	KeepBindings       []string                   `json:"keep_bindings,omitempty"`
+}
+
+const cloudflareWorkerMainModule = "worker.mjs"
+
+func putCloudflareWorker(api *cloudflareClient, scriptName string, module string, metadata cloudflareWorkerMetadata) error {
+	metadataData, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="metadata"`)
+	header.Set("Content-Type", "application/json")
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(metadataData)
+	if err != nil {
+		return err
+	}
+
+	header = make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%[1]s"`, metadata.MainModule))
+	header.Set("Content-Type", "application/javascript+module")
+	part, err = writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write([]byte(module))
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", writer.FormDataContentType())
+
+	_, err = api.Raw(
+		context.Background(),
+		http.MethodPut,
+		fmt.Sprintf("/accounts/%s/workers/scripts/%s", api.account.Identifier, scriptName),
+		body.Bytes(),
+		headers,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to upload worker %s\n%v", scriptName, err)
+	}
+
+	return nil
+}
+
+/*
+Uploading a script creates it or, if it already exists,
+replaces its module, compatibility settings, and bindings.
+That makes creating and updating a worker the same call.
+Durable Object migrations are applied with the upload so
+the classes they create exist as soon as the script does.
+*/
+func uploadCloudflareWorker(p *processorParams) (*CloudflareWorkerOutput, error) {
+	c := p.config.(*CloudflareWorkerConfig)
+
+	// A replaced worker is a new script, so it starts without
+	// an up output and its classes are all new.
+	uo, _ := p.upOutput.(*CloudflareWorkerOutput)
+
+	migration, err := newCloudflareWorkerMigration(c, uo)
+	if err != nil {
+		return nil, err
+	}
+
+	module, err := readCloudflareWorkerModule(p.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	bindings, err := newCloudflareWorkerBindings(p, c)
+	if err != nil {
+		return nil, err
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		return nil, err
+	}
+
+	scriptName := cloudflareResourceName(c.Name)
+
+	metadata := cloudflareWorkerMetadata{
+		MainModule:         cloudflareWorkerMainModule,
+		Bindings:           make([]map[string]interface{}, 0, len(bindings)),
+		CompatibilityDate:  c.CompatibilityDate,
+		CompatibilityFlags: c.CompatibilityFlags,
+		// Secrets are only uploaded when they change (see
+		// setCloudflareWorkerSecretBindings).
+		KeepBindings: []string{string(cloudflare.WorkerSecretTextBindingType)},
+	}
+
+	for name, binding := range bindings {
+		bindingMetadata, err := cloudflareWorkerBindingMetadata(name, binding)
+		if err != nil {
+			return nil, err
+		}
+		metadata.Bindings = append(metadata.Bindings, bindingMetadata)
+	}
+
+	if !migration.isEmpty() {
+		metadata.Migrations = migration
+	}
+
+	err = putCloudflareWorker(api, scriptName, module, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &CloudflareWorkerOutput{
+		ScriptName:           scriptName,
+		ModuleHash:           hashCloudflareWorkerModule(module),
+		MigrationTag:         migration.tag(),
+		DurableObjectClasses: c.durableObjectClassNames(),
+	}
+
+	for _, subresource := range cloudflareWorkerSubresources {
+		err = subresource.put(api, p, output)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return output, nil
+}
+
+func processCloudflareWorkerCreated(p *processorParams) {
+	output, err := uploadCloudflareWorker(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.deployOutput.set(p.name, CLOUDFLARE_WORKER_CREATED, output)
+
+	p.processOkChan <- true
+}
+
+func processCloudflareWorkerUpdated(p *processorParams) {
+	output, err := uploadCloudflareWorker(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.deployOutput.set(p.name, CLOUDFLARE_WORKER_UPDATED, output)
+
+	p.processOkChan <- true
+}
+
+func processCloudflareWorkerDeleted(p *processorParams) {
+	uo, ok := p.upOutput.(*CloudflareWorkerOutput)
+	if !ok {
+		fmt.Println("Error:", p.upOutputErr())
+		p.processOkChan <- false
+		return
+	}
+
+	api, err := newCloudflareAPI(p)
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	for _, subresource := range cloudflareWorkerSubresources {
+		err = subresource.remove(api, p, uo)
+		if err != nil {
+			fmt.Println("Error:", err)
+			p.processOkChan <- false
+			return
+		}
+	}
+
+	err = api.DeleteWorker(context.Background(), api.account, cloudflare.DeleteWorkerParams{
+		ScriptName: uo.ScriptName,
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		p.processOkChan <- false
+		return
+	}
+
+	p.processOkChan <- true
+}
@@ -0,0 +1,138 @@
+package resources
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCloudflareWorkerModulePendingChanges(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "build"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "build", "_core.base.api.index.js"), []byte("export default {};"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		moduleHash string
+		expected   []string
+	}{
+		{
+			name:       "unchanged module",
+			moduleHash: hashCloudflareWorkerModule("export default {};"),
+			expected:   nil,
+		},
+		{
+			name:       "changed module",
+			moduleHash: hashCloudflareWorkerModule("export default { fetch() {} };"),
+			expected:   []string{"module (changed)"},
+		},
+		{
+			name:       "output without a module hash",
+			moduleHash: "",
+			expected:   []string{"module (changed)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &CloudflareWorkerConfig{ConfigCommon: ConfigCommon{Type: "cloudflare-worker", Name: "CORE_BASE_API"}}
+			uo := &CloudflareWorkerOutput{ScriptName: "project-core-base-api", ModuleHash: tt.moduleHash}
+
+			result, err := cloudflareWorkerModuleChanges(dir, c, uo)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("got %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+
+	t.Run("missing build dir", func(t *testing.T) {
+		c := &CloudflareWorkerConfig{ConfigCommon: ConfigCommon{Type: "cloudflare-worker", Name: "CORE_BASE_API"}}
+		uo := &CloudflareWorkerOutput{ScriptName: "project-core-base-api"}
+
+		_, err := cloudflareWorkerModuleChanges(t.TempDir(), c, uo)
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+/*
+Workers that bind to each other are deployed without one of
+the bindings first, then deployed again once the worker it
+binds to exists.
+*/
+func TestServiceBindingCycleIsDeployedTwice(t *testing.T) {
+	processed := make([]string, 0)
+	for _, key := range []processorKeyType{CLOUDFLARE_WORKER_CREATED, CLOUDFLARE_WORKER_UPDATED} {
+		key := key
+		setTestProcessor(t, key, func(p *processorParams) {
+			processed = append(processed, p.name+" "+string(key))
+			p.deployOutput.mu.Lock()
+			p.deployOutput.m[p.name] = &CloudflareWorkerOutput{ScriptName: cloudflareResourceName(p.name)}
+			p.deployOutput.mu.Unlock()
+			p.processOkChan <- true
+		})
+	}
+
+	r := newTestResources(t, newTestUpJsonPath(t, "{}"), map[string][]*exportedConfig{
+		"gas/core-base-api": {
+			{ExportName: "coreBaseApi", Config: config{"type": "cloudflare-worker", "name": "CORE_BASE_API", "services": []interface{}{map[string]interface{}{"binding": "CORE_BASE_AUTH"}}}},
+		},
+		"gas/core-base-auth": {
+			{ExportName: "coreBaseAuth", Config: config{"type": "cloudflare-worker", "name": "CORE_BASE_AUTH", "services": []interface{}{map[string]interface{}{"binding": "CORE_BASE_API"}}}},
+		},
+	})
+	groupTestResources(t, r)
+
+	err := r.Deploy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"CORE_BASE_API cloudflare-worker:CREATED",
+		"CORE_BASE_AUTH cloudflare-worker:CREATED",
+		"CORE_BASE_API cloudflare-worker:UPDATED",
+	}
+	if !reflect.DeepEqual(processed, expected) {
+		t.Errorf("got processors %v, expected %v", processed, expected)
+	}
+}
+
+/*
+Only service bindings can be deferred. A worker can't be
+deployed without the worker its Durable Objects live in.
+*/
+func TestDurableObjectCycleCantBeDeployed(t *testing.T) {
+	durableObjectOf := func(worker string) map[string]interface{} {
+		return map[string]interface{}{
+			"bindings": []interface{}{map[string]interface{}{"binding": "ROOMS", "className": "Room", "worker": worker}},
+		}
+	}
+
+	r := newTestResources(t, newTestUpJsonPath(t, "{}"), map[string][]*exportedConfig{
+		"gas/core-base-api": {
+			{ExportName: "coreBaseApi", Config: config{"type": "cloudflare-worker", "name": "CORE_BASE_API", "durableObjects": durableObjectOf("CORE_BASE_CHAT")}},
+		},
+		"gas/core-base-chat": {
+			{ExportName: "coreBaseChat", Config: config{"type": "cloudflare-worker", "name": "CORE_BASE_CHAT", "durableObjects": durableObjectOf("CORE_BASE_API")}},
+		},
+	})
+
+	err := r.setNameToDeferredDeps()
+	if err == nil || !strings.Contains(err.Error(), "CORE_BASE_API, CORE_BASE_CHAT") {
+		t.Errorf("got error %v, expected a cycle between CORE_BASE_API and CORE_BASE_CHAT", err)
+	}
+}
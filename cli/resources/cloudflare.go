@@ -0,0 +1,133 @@
+package resources
+
+import (
+	"fmt"
+	"gas/helpers"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/spf13/viper"
+)
+
+const defaultCloudflareAccount = "default"
+
+/*
+Named accounts are set in gas.config.json. Each one names the
+env vars its credentials are read from, so credentials never
+end up in config:
+
+	"accounts": {
+	  "dns": {
+	    "accountIdEnv": "DNS_CLOUDFLARE_ACCOUNT_ID",
+	    "apiTokenEnv": "DNS_CLOUDFLARE_API_TOKEN"
+	  }
+	}
+
+Resources without an account option use the default account,
+whose credentials are CLOUDFLARE_ACCOUNT_ID and
+CLOUDFLARE_API_TOKEN unless it's named in accounts.
+*/
+type cloudflareAccountConfig struct {
+	AccountIDEnv string `json:"accountIdEnv"`
+	APITokenEnv  string `json:"apiTokenEnv"`
+}
+
+func cloudflareAccountConfigByName(account string) (*cloudflareAccountConfig, error) {
+	if account == "" {
+		account = defaultCloudflareAccount
+	}
+
+	config, err := readGasConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if result, ok := config.Accounts[account]; ok && result != nil {
+		if result.AccountIDEnv == "" || result.APITokenEnv == "" {
+			return nil, fmt.Errorf("account %s in config file %s requires accountIdEnv and apiTokenEnv", account, viper.ConfigFileUsed())
+		}
+		return result, nil
+	}
+
+	if account == defaultCloudflareAccount {
+		return &cloudflareAccountConfig{
+			AccountIDEnv: "CLOUDFLARE_ACCOUNT_ID",
+			APITokenEnv:  "CLOUDFLARE_API_TOKEN",
+		}, nil
+	}
+
+	return nil, fmt.Errorf("account %s isn't in the accounts of config file %s", account, viper.ConfigFileUsed())
+}
+
+/*
+A Cloudflare client is an API client plus the account it
+acts in, so processors and their helpers never have to work
+out which account a resource belongs to.
+*/
+type cloudflareClient struct {
+	*cloudflare.API
+	account *cloudflare.ResourceContainer
+}
+
+func newCloudflareClient(account string) (*cloudflareClient, error) {
+	config, err := cloudflareAccountConfigByName(account)
+	if err != nil {
+		return nil, err
+	}
+
+	api, err := cloudflare.NewWithAPIToken(os.Getenv(config.APITokenEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	return &cloudflareClient{
+		API:     api,
+		account: cloudflare.AccountIdentifier(os.Getenv(config.AccountIDEnv)),
+	}, nil
+}
+
+/*
+Processors get a client for the account of the resource
+they're deploying.
+*/
+func newCloudflareAPI(p *processorParams) (*cloudflareClient, error) {
+	return newCloudflareClient(p.account())
+}
+
+/*
+Only the accounts a plan touches need credentials, so a
+project with resources in several accounts can be deployed
+with the credentials of just the accounts that changed.
+*/
+func validateCloudflareAccounts(accounts []string) error {
+	missingVars := make([]string, 0)
+	for _, account := range accounts {
+		config, err := cloudflareAccountConfigByName(account)
+		if err != nil {
+			return err
+		}
+		for _, key := range []string{config.AccountIDEnv, config.APITokenEnv} {
+			if os.Getenv(key) == "" && !helpers.IsStringInSlice(missingVars, key) {
+				missingVars = append(missingVars, key)
+			}
+		}
+	}
+
+	if len(missingVars) > 0 {
+		sort.Strings(missingVars)
+		return fmt.Errorf("the following required environment variables are not set -> %s", strings.Join(missingVars, ", "))
+	}
+
+	return nil
+}
+
+/*
+Name used for Cloudflare resources that only allow lowercase
+names (workers, Pages projects, D1 databases, etc.):
+CORE_BASE_API -> project-core-base-api
+*/
+func cloudflareResourceName(name string) string {
+	return helpers.StringToLowerCaseKebab(viper.GetString("project")) + "-" + helpers.CapitalSnakeCaseToKebabCase(name)
+}
@@ -0,0 +1,330 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"gas/helpers"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Config schemas are derived from the config structs resource
+types decode into, so a config is checked against the same
+definitions it's decoded with. Fields without omitempty are
+required. Rules Go types can't express are set with a schema
+tag:
+
+	Metric string `json:"metric" schema:"enum=cosine|euclidean"`
+
+Supported rules are enum, pattern, minimum, maximum and
+maxItems. Schemas use JSON Schema's keywords.
+*/
+type configSchema struct {
+	Dialect              string                   `json:"$schema,omitempty"`
+	Title                string                   `json:"title,omitempty"`
+	Type                 string                   `json:"type,omitempty"`
+	Const                string                   `json:"const,omitempty"`
+	Properties           map[string]*configSchema `json:"properties,omitempty"`
+	Required             []string                 `json:"required,omitempty"`
+	AdditionalProperties interface{}              `json:"additionalProperties,omitempty"`
+	Items                *configSchema            `json:"items,omitempty"`
+	Enum                 []string                 `json:"enum,omitempty"`
+	Pattern              string                   `json:"pattern,omitempty"`
+	Minimum              *float64                 `json:"minimum,omitempty"`
+	Maximum              *float64                 `json:"maximum,omitempty"`
+	MaxItems             *int                     `json:"maxItems,omitempty"`
+}
+
+/*
+A resource type's schema is derived from what its config
+decoder returns for an empty config.
+*/
+func configSchemaOf(resourceType string) *configSchema {
+	decoded := configs[resourceType](config{})
+	result := schemaOfType(reflect.TypeOf(decoded))
+	result.Properties["type"].Const = resourceType
+	return result
+}
+
+func schemaOfType(t reflect.Type) *configSchema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOfType(t.Elem())
+	case reflect.Struct:
+		result := &configSchema{
+			Type:                 "object",
+			Properties:           make(map[string]*configSchema),
+			Required:             make([]string, 0),
+			AdditionalProperties: false,
+		}
+		addStructFieldSchemas(result, t)
+		return result
+	case reflect.Map:
+		return &configSchema{
+			Type:                 "object",
+			AdditionalProperties: schemaOfType(t.Elem()),
+		}
+	case reflect.Slice, reflect.Array:
+		return &configSchema{
+			Type:  "array",
+			Items: schemaOfType(t.Elem()),
+		}
+	case reflect.String:
+		return &configSchema{Type: "string"}
+	case reflect.Bool:
+		return &configSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &configSchema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		minimum := float64(0)
+		maximum := float64(uint64(1)<<(t.Bits()) - 1)
+		return &configSchema{Type: "integer", Minimum: &minimum, Maximum: &maximum}
+	case reflect.Float32, reflect.Float64:
+		return &configSchema{Type: "number"}
+	}
+	return &configSchema{}
+}
+
+/*
+Embedded structs (e.g. ConfigCommon) are flattened like
+encoding/json flattens them.
+*/
+func addStructFieldSchemas(s *configSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addStructFieldSchemas(s, field.Type)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldSchema := schemaOfType(field.Type)
+		applySchemaTag(fieldSchema, field.Tag.Get("schema"))
+		s.Properties[name] = fieldSchema
+
+		if !strings.Contains(options, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func applySchemaTag(s *configSchema, tag string) {
+	if tag == "" {
+		return
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		switch key {
+		case "enum":
+			s.Enum = strings.Split(value, "|")
+		case "pattern":
+			s.Pattern = value
+		case "minimum":
+			minimum, _ := strconv.ParseFloat(value, 64)
+			s.Minimum = &minimum
+		case "maximum":
+			maximum, _ := strconv.ParseFloat(value, 64)
+			s.Maximum = &maximum
+		case "maxItems":
+			maxItems, _ := strconv.Atoi(value)
+			s.MaxItems = &maxItems
+		}
+	}
+}
+
+/*
+Returns every problem with the value rather than the first,
+each prefixed with the path of the offending field (e.g.
+coreBaseApi.kv[0].binding). Nulls are treated as missing.
+*/
+func (s *configSchema) validate(path string, value interface{}) []string {
+	if value == nil {
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %s", path, jsonTypeName(value))}
+		}
+
+		result := make([]string, 0)
+		for _, key := range s.Required {
+			if object[key] == nil {
+				result = append(result, fmt.Sprintf("%s: is required", joinSchemaPath(path, key)))
+			}
+		}
+
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if property, ok := s.Properties[key]; ok {
+				result = append(result, property.validate(joinSchemaPath(path, key), object[key])...)
+			} else if additional, ok := s.AdditionalProperties.(*configSchema); ok {
+				result = append(result, additional.validate(joinSchemaPath(path, key), object[key])...)
+			} else {
+				result = append(result, fmt.Sprintf("%s: unknown field", joinSchemaPath(path, key)))
+			}
+		}
+		return result
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected array, got %s", path, jsonTypeName(value))}
+		}
+
+		result := make([]string, 0)
+		if s.MaxItems != nil && len(array) > *s.MaxItems {
+			result = append(result, fmt.Sprintf("%s: can have at most %d items, got %d", path, *s.MaxItems, len(array)))
+		}
+		for i, item := range array {
+			result = append(result, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+		}
+		return result
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected string, got %s", path, jsonTypeName(value))}
+		}
+		if s.Const != "" && str != s.Const {
+			return []string{fmt.Sprintf("%s: expected %q, got %q", path, s.Const, str)}
+		}
+		if len(s.Enum) > 0 && !helpers.IsStringInSlice(s.Enum, str) {
+			return []string{fmt.Sprintf("%s: expected one of %s, got %q", path, strings.Join(s.Enum, ", "), str)}
+		}
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(str) {
+			return []string{fmt.Sprintf("%s: %q doesn't match %s", path, str, s.Pattern)}
+		}
+		return nil
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected %s, got %s", path, s.Type, jsonTypeName(value))}
+		}
+		if s.Type == "integer" && number != math.Trunc(number) {
+			return []string{fmt.Sprintf("%s: expected integer, got %v", path, number)}
+		}
+		if s.Minimum != nil && number < *s.Minimum {
+			return []string{fmt.Sprintf("%s: must be at least %v, got %v", path, *s.Minimum, number)}
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			return []string{fmt.Sprintf("%s: must be at most %v, got %v", path, *s.Maximum, number)}
+		}
+		return nil
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s: expected boolean, got %s", path, jsonTypeName(value))}
+		}
+		return nil
+	}
+
+	return nil
+}
+
+func joinSchemaPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+const jsonSchemaDialect = "http://json-schema.org/draft-07/schema#"
+
+/*
+Schemas are written to .gas/schemas by default, where the
+gas.config.json of new projects points its $schema.
+*/
+var DefaultSchemasDir = filepath.Join(".gas", "schemas")
+
+/*
+WriteSchemas writes JSON Schema files for gas.config.json and
+for each resource type's config to dir, so editors can
+complete configs and CI can check them without gas:
+
+	gas.config.schema.json
+	cloudflare-kv.schema.json
+	...
+
+Returns the paths of the files written.
+*/
+func WriteSchemas(dir string) ([]string, error) {
+	nameToSchema := map[string]*configSchema{
+		"gas.config": gasConfigSchema(),
+	}
+	for resourceType := range configs {
+		nameToSchema[resourceType] = configSchemaOf(resourceType)
+	}
+
+	names := make([]string, 0, len(nameToSchema))
+	for name := range nameToSchema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create schemas dir %s\n%v", dir, err)
+	}
+
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		schema := nameToSchema[name]
+		schema.Dialect = jsonSchemaDialect
+		schema.Title = name
+
+		data, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		path := filepath.Join(dir, name+".schema.json")
+		err = os.WriteFile(path, append(data, '\n'), 0644)
+		if err != nil {
+			return nil, fmt.Errorf("unable to write schema file %s\n%v", path, err)
+		}
+
+		result = append(result, path)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,275 @@
+package resources
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type testSchemaConfig struct {
+	ConfigCommon
+	Metric     string            `json:"metric" schema:"enum=cosine|euclidean"`
+	Date       string            `json:"date,omitempty" schema:"pattern=^\\d{4}-\\d{2}-\\d{2}$"`
+	Dimensions int               `json:"dimensions" schema:"minimum=1,maximum=1536"`
+	Port       uint16            `json:"port,omitempty"`
+	Hosts      []string          `json:"hosts,omitempty" schema:"maxItems=2"`
+	Vars       map[string]string `json:"vars,omitempty"`
+	Enabled    *bool             `json:"enabled,omitempty"`
+	Internal   string            `json:"-"`
+}
+
+/*
+Invalid configs are reported together, each with the index
+file and line of its export, instead of stopping at the
+first.
+*/
+func TestInvalidConfigsAreLocated(t *testing.T) {
+	kvDir := t.TempDir()
+	apiDir := t.TempDir()
+	writeIndexFile := func(dir string, source string) {
+		t.Helper()
+		err := os.MkdirAll(filepath.Join(dir, "src"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, "src", "index.ts"), []byte(source), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeIndexFile(kvDir, "export const coreBaseKv = {\n  type: \"cloudflare-kv\",\n}\n\nexport const coreBaseCache = {}\n")
+	writeIndexFile(apiDir, "import { coreBaseKv } from \"core-base-kv\"\n\nexport const coreBaseApi = {}\n")
+
+	r := New()
+	r.containerSubdirPathToIndexFilePath = containerSubdirPathToIndexFilePath{
+		kvDir:  filepath.Join(kvDir, "src", "index.ts"),
+		apiDir: filepath.Join(apiDir, "src", "index.ts"),
+	}
+	r.runNodeJsConfigScriptResult = runNodeJsConfigScriptResult{
+		kvDir: {
+			{ExportName: "coreBaseKv", Config: config{"type": "cloudflare-kv"}},
+			{ExportName: "coreBaseCache", Config: config{"type": "cloudflare-kb", "name": "CORE_BASE_CACHE"}},
+		},
+		apiDir: {
+			{ExportName: "coreBaseApi", Config: config{"type": "cloudflare-worker", "name": "core-base-api", "compatibiltyDate": "2024-01-01"}},
+		},
+	}
+
+	kvIndexFilePath := filepath.Join(kvDir, "src", "index.ts")
+	apiIndexFilePath := filepath.Join(apiDir, "src", "index.ts")
+	expected := []string{
+		kvIndexFilePath + ":1: coreBaseKv.name: is required",
+		kvIndexFilePath + `:5: coreBaseCache.type: unknown resource type "cloudflare-kb"`,
+		apiIndexFilePath + `:3: coreBaseApi.name: "core-base-api" doesn't match ^[A-Z][A-Z0-9]*(_[A-Z0-9]+)*$`,
+		apiIndexFilePath + ":3: coreBaseApi.compatibiltyDate: unknown field",
+	}
+
+	problems := r.setNameToConfig()
+	sort.Strings(problems)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("got problems %q, expected %q", problems, expected)
+	}
+}
+
+func TestConfigSchemaValidate(t *testing.T) {
+	s := schemaOfType(reflect.TypeOf(&testSchemaConfig{}))
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"type":       "test",
+			"name":       "CORE_BASE_TEST",
+			"metric":     "cosine",
+			"dimensions": float64(768),
+		}
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		result := valid()
+		result[key] = value
+		return result
+	}
+	without := func(key string) map[string]interface{} {
+		result := valid()
+		delete(result, key)
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected []string
+	}{
+		{
+			name:     "valid",
+			value:    valid(),
+			expected: []string{},
+		},
+		{
+			name:     "not an object",
+			value:    "test",
+			expected: []string{"coreBaseTest: expected object, got string"},
+		},
+		{
+			name:     "missing required field",
+			value:    without("metric"),
+			expected: []string{"coreBaseTest.metric: is required"},
+		},
+		{
+			name:     "null required field",
+			value:    with("metric", nil),
+			expected: []string{"coreBaseTest.metric: is required"},
+		},
+		{
+			name:     "unknown field",
+			value:    with("metrc", "cosine"),
+			expected: []string{"coreBaseTest.metrc: unknown field"},
+		},
+		{
+			name:     "value not in enum",
+			value:    with("metric", "dot"),
+			expected: []string{`coreBaseTest.metric: expected one of cosine, euclidean, got "dot"`},
+		},
+		{
+			name:     "value not matching pattern",
+			value:    with("date", "18/10/2026"),
+			expected: []string{`coreBaseTest.date: "18/10/2026" doesn't match ^\d{4}-\d{2}-\d{2}$`},
+		},
+		{
+			name:     "number below minimum",
+			value:    with("dimensions", float64(0)),
+			expected: []string{"coreBaseTest.dimensions: must be at least 1, got 0"},
+		},
+		{
+			name:     "number above maximum",
+			value:    with("dimensions", float64(2048)),
+			expected: []string{"coreBaseTest.dimensions: must be at most 1536, got 2048"},
+		},
+		{
+			name:     "fraction for integer",
+			value:    with("dimensions", 1.5),
+			expected: []string{"coreBaseTest.dimensions: expected integer, got 1.5"},
+		},
+		{
+			name:     "too many items",
+			value:    with("hosts", []interface{}{"a", "b", "c"}),
+			expected: []string{"coreBaseTest.hosts: can have at most 2 items, got 3"},
+		},
+		{
+			name:     "wrong item type",
+			value:    with("hosts", []interface{}{"a", true}),
+			expected: []string{"coreBaseTest.hosts[1]: expected string, got boolean"},
+		},
+		{
+			name:     "wrong map value type",
+			value:    with("vars", map[string]interface{}{"MODE": float64(1)}),
+			expected: []string{"coreBaseTest.vars.MODE: expected string, got number"},
+		},
+		{
+			name: "several problems",
+			value: map[string]interface{}{
+				"type":       "test",
+				"name":       "CORE_BASE_TEST",
+				"dimensions": "768",
+				"enabled":    "yes",
+			},
+			expected: []string{
+				"coreBaseTest.metric: is required",
+				"coreBaseTest.dimensions: expected integer, got string",
+				"coreBaseTest.enabled: expected boolean, got string",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := s.validate("coreBaseTest", tt.value)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("got %q, expected %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+/*
+Template index files are evaluated like a project's are, in
+a project that has the resources package and stubs of the
+other packages templates import.
+*/
+func TestTemplateConfigsMatchSchemas(t *testing.T) {
+	indexFilePaths, err := filepath.Glob(filepath.Join("..", "..", "templates", "*", "src", "index.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexFilePaths) == 0 {
+		t.Fatal("no template index files found")
+	}
+
+	projectDir := t.TempDir()
+
+	resourcesPackage, err := os.ReadFile(filepath.Join("..", "..", "packages", "resources", "src", "index.resources.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	projectFiles := map[string]string{
+		"node_modules/@gasoline-dev/resources/package.json": `{"name": "@gasoline-dev/resources", "main": "index.ts"}`,
+		"node_modules/@gasoline-dev/resources/index.ts":     string(resourcesPackage),
+		"node_modules/hono/package.json":                    `{"name": "hono", "main": "index.js"}`,
+		"node_modules/hono/index.js":                        "export class Hono { get() { return this; } }",
+	}
+
+	r := New()
+	r.containerSubdirPathToIndexFilePath = make(containerSubdirPathToIndexFilePath)
+
+	for _, indexFilePath := range indexFilePaths {
+		template := filepath.Base(filepath.Dir(filepath.Dir(indexFilePath)))
+		source, err := os.ReadFile(indexFilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subdirPath := filepath.Join(projectDir, "gas", template)
+		projectFiles[filepath.Join("gas", template, "src", "index.ts")] = string(source)
+		r.containerSubdirPathToIndexFilePath[subdirPath] = filepath.Join(subdirPath, "src", "index.ts")
+	}
+
+	for path, contents := range projectFiles {
+		path = filepath.Join(projectDir, path)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = r.runEmbeddedConfigScripts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for subdirPath, exports := range r.runNodeJsConfigScriptResult {
+		template := filepath.Base(subdirPath)
+		for _, export := range exports {
+			t.Run(template+"/"+export.ExportName, func(t *testing.T) {
+				resourceType := export.Config["type"].(string)
+				if _, ok := configs[resourceType]; !ok {
+					t.Fatalf("unknown resource type %q", resourceType)
+				}
+
+				// Templates leave names empty for whoever adds
+				// them to fill in.
+				if export.Config["name"] == "" {
+					export.Config["name"] = "TEMPLATE"
+				}
+
+				for _, problem := range configSchemaOf(resourceType).validate(export.ExportName, export.Config) {
+					t.Error(problem)
+				}
+			})
+		}
+	}
+}
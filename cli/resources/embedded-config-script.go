@@ -0,0 +1,71 @@
+package resources
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dop251/goja"
+	esbuild "github.com/evanw/esbuild/pkg/api"
+)
+
+/*
+Without Node.js, each package's index file is bundled on its
+own and evaluated in goja, so an error names the index file
+whose configs couldn't be evaluated. goja is just the language,
+so console is the only global provided and index files that
+use Node.js APIs when they're imported fail.
+*/
+func (r *Resources) runEmbeddedConfigScripts() error {
+	r.runNodeJsConfigScriptResult = make(runNodeJsConfigScriptResult)
+
+	for _, subdirPath := range r.containerSubdirPathsWithIndexFile() {
+		indexFilePath := r.containerSubdirPathToIndexFilePath[subdirPath]
+
+		script, err := r.bundleConfigScript([]string{subdirPath}, esbuild.FormatIIFE, esbuild.ES2017)
+		if err != nil {
+			return err
+		}
+
+		output, err := runEmbeddedConfigScript(script)
+		if err != nil {
+			return fmt.Errorf("unable to evaluate configs in %s\n%v", indexFilePath, err)
+		}
+
+		result, err := parseConfigScriptOutput(output)
+		if err != nil {
+			return fmt.Errorf("unable to evaluate configs in %s\n%v", indexFilePath, err)
+		}
+
+		r.runNodeJsConfigScriptResult[subdirPath] = result[subdirPath]
+	}
+
+	return nil
+}
+
+func runEmbeddedConfigScript(script string) (string, error) {
+	vm := goja.New()
+
+	var output strings.Builder
+
+	log := func(call goja.FunctionCall) goja.Value {
+		args := make([]string, 0, len(call.Arguments))
+		for _, arg := range call.Arguments {
+			args = append(args, arg.String())
+		}
+		output.WriteString(strings.Join(args, " ") + "\n")
+		return goja.Undefined()
+	}
+
+	console := vm.NewObject()
+	for _, method := range []string{"debug", "error", "info", "log", "warn"} {
+		console.Set(method, log)
+	}
+	vm.Set("console", console)
+
+	_, err := vm.RunString(script)
+	if err != nil {
+		return "", err
+	}
+
+	return output.String(), nil
+}
@@ -0,0 +1,64 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+/*
+gas.config.json. It's read through viper for the options
+commands use (e.g. project), and read again here for the
+parts resource types use because viper lowercases keys, and
+var and account names are case sensitive. Its schema (see
+gas schema) is derived from this struct too.
+*/
+type gasConfig struct {
+	Schema                   string                              `json:"$schema,omitempty"`
+	Project                  string                              `json:"project"`
+	ResourceContainerDirPath string                              `json:"resourceContainerDirPath,omitempty"`
+	UpJsonPath               string                              `json:"upJsonPath,omitempty"`
+	SecretsJsonPath          string                              `json:"secretsJsonPath,omitempty"`
+	Accounts                 map[string]*cloudflareAccountConfig `json:"accounts,omitempty"`
+	Stages                   map[string]*stageConfig             `json:"stages,omitempty"`
+}
+
+func gasConfigSchema() *configSchema {
+	return schemaOfType(reflect.TypeOf(gasConfig{}))
+}
+
+func readGasConfig() (*gasConfig, error) {
+	result := &gasConfig{}
+
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		return result, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %s\n%v", path, err)
+	}
+
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s\n%v", path, err)
+	}
+
+	problems := gasConfigSchema().validate("", value)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid config file %s\n%s", path, strings.Join(problems, "\n"))
+	}
+
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s\n%v", path, err)
+	}
+
+	return result, nil
+}
@@ -2,8 +2,8 @@ package resources
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gas/graph"
 	"gas/helpers"
@@ -12,43 +12,52 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/cloudflare/cloudflare-go"
+	esbuild "github.com/evanw/esbuild/pkg/api"
 	"github.com/spf13/viper"
 )
 
 type Resources struct {
-	containerDir                string
-	containerSubdirPaths        containerSubdirPaths
-	nameToPackageJson           nameToPackageJson
-	packageJsonNameToName       packageJsonNameToName
-	nameToDeps                  nameToDeps
-	nameToIndexFilePath         nameToIndexFilePath
-	nameToIndexFileContent      nameToIndexFileContent
-	nameToConfigData            nameToConfigData
-	groupToDepthToNames         graph.GroupToDepthToNodes
-	namesWithInDegreesOfZero    graph.NodesWithInDegreesOfZero
-	nameToIntermediates         graph.NodeToIntermediates
-	depthToName                 graph.DepthToNode
-	nameToDepth                 graph.NodeToDepth
-	nodeJsConfigScript          nodeJsConfigScript
-	runNodeJsConfigScriptResult runNodeJsConfigScriptResult
-	nameToConfig                nameToConfig
-	upJsonPath                  string
-	upJson                      upJson
-	upNameToDeps                upNameToDeps
-	upNameToConfig              upNameToConfig
-	upNameToOutput              upNameToOutput
-	nameToGroup                 nameToGroup
-	groupsWithStateChanges      groupsWithStateChanges
-	groupToNames                groupToNames
-	groupToHighestDeployDepth   groupToHighestDeployDepth
-	nameToState                 nameToState
-	nameToDeployStateContainer  *nameToDeployStateContainer
-	nameToDeployOutputContainer *nameToDeployOutputContainer
+	containerDir                         string
+	containerSubdirPaths                 containerSubdirPaths
+	containerSubdirPathToPackageJson     containerSubdirPathToPackageJson
+	packageJsonNameToContainerSubdirPath packageJsonNameToContainerSubdirPath
+	containerSubdirPathToIndexFilePath   containerSubdirPathToIndexFilePath
+	containerSubdirPathToNames           containerSubdirPathToNames
+	nameToContainerSubdirPath            nameToContainerSubdirPath
+	nameToIndexFilePath                  nameToIndexFilePath
+	nameToDeps                           nameToDeps
+	nameToDeferredDeps                   nameToDeferredDeps
+	groupToDepthToNames                  graph.GroupToDepthToNodes
+	namesWithInDegreesOfZero             graph.NodesWithInDegreesOfZero
+	nameToIntermediates                  graph.NodeToIntermediates
+	depthToName                          graph.DepthToNode
+	nameToDepth                          graph.NodeToDepth
+	nodeJsConfigScript                   nodeJsConfigScript
+	runNodeJsConfigScriptResult          runNodeJsConfigScriptResult
+	nameToConfig                         nameToConfig
+	nameToConfigLocation                 nameToConfigLocation
+	upJsonPath                           string
+	isUpJsonOptional                     bool
+	upJson                               upJson
+	newUpJson                            upJson
+	upNameToDeps                         upNameToDeps
+	upNameToConfig                       upNameToConfig
+	upNameToOutput                       upNameToOutput
+	nameToGroup                          nameToGroup
+	groupsWithStateChanges               groupsWithStateChanges
+	groupToNames                         groupToNames
+	nameToState                          nameToState
+	nameToConfigChanges                  nameToConfigChanges
+	nameToPendingChanges                 nameToPendingChanges
+	nameToDeployStateContainer           *nameToDeployStateContainer
+	nameToDeployOutputContainer          *nameToDeployOutputContainer
+	undeletedReplacedNamesContainer      *undeletedReplacedNamesContainer
 }
 
 func New() *Resources {
@@ -75,14 +84,18 @@ a merge of currrent resource deps and up resource deps has to
 happen before setting the resource graph (in the context of
 the "up" command)*.
 
-Additionally, the resource graph has to be set before setting
-the Node.js config script because the script has to write the
-configs in bottom-up dependency order (see setNodeJsConfigScript).
+Additionally, the resource graph has to be set after configs
+are evaluated because whether a dependency cycle can be
+deployed depends on configs (see setNameToDeferredDeps).
+
+Current resources themselves, and so their deps, are only
+known once configs are evaluated, since a package can have
+several resources named by their configs' names.
 
 Summary: unlike initUp(), init current funcs have to be split up
 because a merge between current and up .json file resource has to
-happen before setting the graph, and the graph has to be set before
-setting the Node.js config script. Therefore, there can't be one
+happen before setting the graph, and configs have to be evaluated
+before setting the graph. Therefore, there can't be one
 initCurr() func.
 
 * The merge has to happen because the up .json file may have
@@ -102,9 +115,178 @@ func (r *Resources) InitWithUp() error {
 		return err
 	}
 
+	err = r.initParseConfigCurr()
+	if err != nil {
+		return err
+	}
+
+	err = r.initPostConfigCurr()
+	if err != nil {
+		return err
+	}
+
 	r.nameToDeps = helpers.MergeStringSliceMaps(r.upNameToDeps, r.nameToDeps)
 
-	g := graph.New(graph.NodeToDeps(r.nameToDeps))
+	err = r.setNameToPendingChanges()
+	if err != nil {
+		return err
+	}
+
+	r.setNameToState()
+	r.setNameToConfigChanges()
+	r.setNameToStateOfReplacedDependents()
+
+	err = r.setNameToDeferredDeps()
+	if err != nil {
+		return err
+	}
+
+	r.setGraph(r.nameToDepsWithoutDeferred())
+
+	r.setNameToGroup()
+	r.setGroupsWithStateChanges()
+	r.setGroupToNames()
+
+	return nil
+}
+
+/*
+InitWithOptionalUp is InitWithUp for commands that can run
+before the first deploy. A missing up .json file is treated
+as an empty one, so every current resource is CREATED.
+*/
+func (r *Resources) InitWithOptionalUp() error {
+	r.isUpJsonOptional = true
+	return r.InitWithUp()
+}
+
+/*
+Init only derives current resources, for commands that need
+to know what resources exist but not what changed.
+*/
+func (r *Resources) Init() error {
+	err := r.initPreParseConfigCurr()
+	if err != nil {
+		return err
+	}
+
+	err = r.initParseConfigCurr()
+	if err != nil {
+		return err
+	}
+
+	return r.initPostConfigCurr()
+}
+
+func (r *Resources) HasName(name string) bool {
+	_, ok := r.nameToConfig[name]
+	return ok
+}
+
+/*
+Preflight checks the credentials of the accounts the plan
+touches, and that their tokens have the permissions the plan
+needs, before anything is deployed. Only the accounts of
+resources that will be deployed need credentials.
+*/
+func (r *Resources) Preflight() error {
+	nameToState := make(map[string]stateType)
+	for name, state := range r.nameToState {
+		if state != stateType(UNCHANGED) {
+			nameToState[name] = state
+		}
+	}
+
+	accountToPermissions := r.accountToPermissions(nameToState)
+
+	accounts := make([]string, 0, len(accountToPermissions))
+	for account := range accountToPermissions {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+
+	err := validateCloudflareAccounts(accounts)
+	if err != nil {
+		return err
+	}
+
+	for _, account := range accounts {
+		err := checkCloudflareTokenPermissions(account, accountToPermissions[account])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Required permissions are the permissions needed to deploy
+every resource, current or up, from scratch: creating current
+resources and deleting up resources that no longer exist.
+They're what a least-privilege CI token needs.
+*/
+func (r *Resources) RequiredPermissions() map[string][]string {
+	nameToState := make(map[string]stateType)
+	for name := range r.upNameToConfig {
+		nameToState[name] = stateType(DELETED)
+	}
+	for name := range r.nameToConfig {
+		nameToState[name] = stateType(CREATED)
+	}
+	return r.accountToPermissions(nameToState)
+}
+
+/*
+An UPDATED resource needs the permissions of both its current
+and up config since it may be removing things (e.g. routes)
+its current config no longer has. A replaced resource is
+created with its current config and deleted with its up
+config, which may be in another account.
+*/
+func (r *Resources) accountToPermissions(nameToState map[string]stateType) map[string][]string {
+	result := make(map[string][]string)
+	add := func(config interface{}, state stateType) {
+		if config == nil {
+			return
+		}
+		account := resourceAccountOf(config)
+		if _, ok := result[account]; !ok {
+			result[account] = make([]string, 0)
+		}
+		for _, permissions := range resourcePermissions[resourceTypeOf(config)] {
+			for _, permission := range permissions(config, state) {
+				if !helpers.IsStringInSlice(result[account], permission) {
+					result[account] = append(result[account], permission)
+				}
+			}
+		}
+	}
+
+	for name, state := range nameToState {
+		switch {
+		case state == stateType(CREATED):
+			add(r.nameToConfig[name], state)
+		case state == stateType(DELETED):
+			add(r.upNameToConfig[name], state)
+		case state == stateType(UPDATED) && r.shouldReplace(name):
+			add(r.nameToConfig[name], stateType(CREATED))
+			add(r.upNameToConfig[name], stateType(DELETED))
+		default:
+			add(r.nameToConfig[name], state)
+			add(r.upNameToConfig[name], state)
+		}
+	}
+
+	for account := range result {
+		sort.Strings(result[account])
+	}
+
+	return result
+}
+
+func (r *Resources) setGraph(nameToDeps map[string][]string) {
+	g := graph.New(graph.NodeToDeps(nameToDeps))
 
 	r.groupToDepthToNames = g.GroupToDepthToNodes
 
@@ -115,19 +297,90 @@ func (r *Resources) InitWithUp() error {
 	r.depthToName = g.DepthToNode
 
 	r.nameToDepth = g.NodeToDepth
+}
 
-	r.initParseConfigCurr()
+type nameToDeferredDeps map[string][]string
 
-	r.initPostConfigCurr()
+/*
+Deferred deps are deps within a cycle that a resource can be
+deployed without, such as a worker's service binding to
+another worker that calls it back. They're left out of the
+deploy graph, and resources are deployed again once their
+deferred deps are deployed (see deployDeferredDeps).
+
+A cycle that can't be broken by deferring deps can't be
+deployed.
+*/
+func (r *Resources) setNameToDeferredDeps() error {
+	r.nameToDeferredDeps = make(nameToDeferredDeps)
+
+	// Deps are deferred one at a time so no more are deferred
+	// than needed. For example, given A->B and B->A, only one
+	// of them is deferred.
+	for {
+		cycles := graph.Cycles(graph.NodeToDeps(r.nameToDepsWithoutDeferred()))
+		if len(cycles) == 0 {
+			return nil
+		}
 
-	r.setNameToGroup()
-	r.setGroupsWithStateChanges()
-	r.setGroupToNames()
-	r.setGroupToHighestDeployDepth()
+		name, dep, ok := r.findDeferrableDep(cycles[0])
+		if !ok {
+			return fmt.Errorf("unable to deploy dependency cycle between %s\nonly cycles of service bindings between workers can be deployed", strings.Join(cycles[0], ", "))
+		}
 
-	r.setNameToState()
+		r.nameToDeferredDeps[name] = append(r.nameToDeferredDeps[name], dep)
+	}
+}
 
-	return nil
+func (r *Resources) findDeferrableDep(cycle []string) (string, string, bool) {
+	for _, name := range cycle {
+		deps := append(make([]string, 0), r.nameToDeps[name]...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if helpers.IsStringInSlice(cycle, dep) && !r.isDeferredDep(name, dep) && r.isDeferrableDep(name, dep) {
+				return name, dep, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func (r *Resources) isDeferrableDep(name string, dep string) bool {
+	config := r.configOrUpConfig(name)
+	depConfig := r.configOrUpConfig(dep)
+	if config == nil || depConfig == nil {
+		return false
+	}
+	for _, isDeferrable := range deferrableDeps[resourceTypeOf(config)] {
+		if isDeferrable(config, depConfig) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Resources) isDeferredDep(name string, dep string) bool {
+	return helpers.IsStringInSlice(r.nameToDeferredDeps[name], dep)
+}
+
+func (r *Resources) nameToDepsWithoutDeferred() map[string][]string {
+	result := make(map[string][]string)
+	for name, deps := range r.nameToDeps {
+		result[name] = make([]string, 0, len(deps))
+		for _, dep := range deps {
+			if !r.isDeferredDep(name, dep) {
+				result[name] = append(result[name], dep)
+			}
+		}
+	}
+	return result
+}
+
+func (r *Resources) configOrUpConfig(name string) interface{} {
+	if config, ok := r.nameToConfig[name]; ok {
+		return config
+	}
+	return r.upNameToConfig[name]
 }
 
 func (r *Resources) initPreParseConfigCurr() error {
@@ -138,21 +391,34 @@ func (r *Resources) initPreParseConfigCurr() error {
 		return err
 	}
 
-	err = r.setNameToPackageJson()
+	err = r.setContainerSubdirPathToPackageJson()
 	if err != nil {
 		return err
 	}
 
-	r.setPackageJsonNameToName()
+	r.setPackageJsonNameToContainerSubdirPath()
 
-	r.setNameToDeps()
+	err = r.setContainerSubdirPathToIndexFilePath()
+	if err != nil {
+		return err
+	}
 
-	err = r.setNameToIndexFilePath()
+	return nil
+}
+
+func (r *Resources) initParseConfigCurr() error {
+	// Configs are evaluated with Node.js when it's installed
+	// and with an embedded JavaScript runtime otherwise.
+	if !isNodeJsInstalled() {
+		return r.runEmbeddedConfigScripts()
+	}
+
+	err := r.setNodeJsConfigScript()
 	if err != nil {
 		return err
 	}
 
-	err = r.setNameToIndexFileContent()
+	err = r.runNodeJsConfigScript()
 	if err != nil {
 		return err
 	}
@@ -160,21 +426,71 @@ func (r *Resources) initPreParseConfigCurr() error {
 	return nil
 }
 
-func (r *Resources) initParseConfigCurr() error {
-	r.setNameToConfigData()
+func (r *Resources) initPostConfigCurr() error {
+	problems := r.setNameToConfig()
 
-	r.setNodeJsConfigScript()
-	err := r.runNodeJsConfigScript()
+	err := r.applyStageConfigs()
 	if err != nil {
 		return err
 	}
 
+	problems = append(problems, r.validateNameToConfig()...)
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid resource configs\n%s", strings.Join(problems, "\n"))
+	}
+
+	r.setNameToDeps()
+
 	return nil
 }
 
-func (r *Resources) initPostConfigCurr() {
-	r.setNameToConfig()
-	r.setNameToState()
+/*
+Stage configs are applied to current configs only. Up configs
+were written with their stage config already applied, so a
+change to gas.config.json shows up as a config change.
+*/
+func (r *Resources) applyStageConfigs() error {
+	stage, err := readStageConfig()
+	if err != nil {
+		return err
+	}
+
+	for name, config := range r.nameToConfig {
+		for _, apply := range stageConfigs[resourceTypeOf(config)] {
+			err := apply(config, stage)
+			if err != nil {
+				return fmt.Errorf("unable to apply stage %s config to %s\n%v", viper.GetString("stage"), name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+Validators run on decoded configs, so they only see configs
+that match their schema. Problems point at the config's
+export.
+*/
+func (r *Resources) validateNameToConfig() []string {
+	names := make([]string, 0, len(r.nameToConfig))
+	for name := range r.nameToConfig {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]string, 0)
+	for _, name := range names {
+		config := r.nameToConfig[name]
+		for _, validator := range validators[resourceTypeOf(config)] {
+			err := validator(config)
+			if err != nil {
+				result = append(result, fmt.Sprintf("%s: %v", r.nameToConfigLocation[name], err))
+			}
+		}
+	}
+
+	return result
 }
 
 func (r *Resources) initUp() error {
@@ -185,11 +501,14 @@ func (r *Resources) initUp() error {
 		return err
 	}
 
+	err = r.setUpNameToConfig()
+	if err != nil {
+		return err
+	}
+
 	r.setUpNameToDeps()
-	r.setUpNameToConfig()
-	r.setUpNameToOutput()
 
-	return nil
+	return r.setUpNameToOutput()
 }
 
 type containerSubdirPaths []string
@@ -210,23 +529,22 @@ func (r *Resources) setContainerSubdirPaths() error {
 	return nil
 }
 
-type nameToPackageJson map[string]*packageJson
+type containerSubdirPathToPackageJson map[string]*packageJson
 
 type packageJson struct {
-	Name            string            `json:"name"`
-	Main            string            `json:"main"`
-	Types           string            `json:"types"`
-	Scripts         map[string]string `json:"scripts"`
-	Dependencies    map[string]string `json:"dependencies,omitempty"`
-	DevDependencies map[string]string `json:"devDependencies,omitempty"`
+	Name             string            `json:"name"`
+	Main             string            `json:"main"`
+	Types            string            `json:"types"`
+	Scripts          map[string]string `json:"scripts"`
+	Dependencies     map[string]string `json:"dependencies,omitempty"`
+	DevDependencies  map[string]string `json:"devDependencies,omitempty"`
+	PeerDependencies map[string]string `json:"peerDependencies,omitempty"`
 }
 
-func (r *Resources) setNameToPackageJson() error {
-	r.nameToPackageJson = make(nameToPackageJson)
+func (r *Resources) setContainerSubdirPathToPackageJson() error {
+	r.containerSubdirPathToPackageJson = make(containerSubdirPathToPackageJson)
 
 	for _, subdirPath := range r.containerSubdirPaths {
-		resourceName := convertContainerSubdirPathToName(subdirPath)
-
 		packageJsonPath := filepath.Join(subdirPath, "package.json")
 
 		data, err := os.ReadFile(packageJsonPath)
@@ -240,61 +558,29 @@ func (r *Resources) setNameToPackageJson() error {
 			return fmt.Errorf("unable to parse %s\n%v", packageJsonPath, err)
 		}
 
-		r.nameToPackageJson[resourceName] = &packageJson
+		r.containerSubdirPathToPackageJson[subdirPath] = &packageJson
 	}
 
 	return nil
 }
 
-func convertContainerSubdirPathToName(subdirPath string) string {
-	subdirName := filepath.Base(subdirPath)
-	snakeCaseResourceName := strings.ReplaceAll(subdirName, "-", "_")
-	screamingSnakeCaseResourceName := strings.ToUpper(snakeCaseResourceName)
-	return screamingSnakeCaseResourceName
-}
-
-type packageJsonNameToName map[string]string
+type packageJsonNameToContainerSubdirPath map[string]string
 
-func (r *Resources) setPackageJsonNameToName() {
-	r.packageJsonNameToName = make(packageJsonNameToName)
-	for resourceName, packageJson := range r.nameToPackageJson {
-		r.packageJsonNameToName[packageJson.Name] = resourceName
+func (r *Resources) setPackageJsonNameToContainerSubdirPath() {
+	r.packageJsonNameToContainerSubdirPath = make(packageJsonNameToContainerSubdirPath)
+	for subdirPath, packageJson := range r.containerSubdirPathToPackageJson {
+		r.packageJsonNameToContainerSubdirPath[packageJson.Name] = subdirPath
 	}
 }
 
-type nameToDeps map[string][]string
+type containerSubdirPathToIndexFilePath map[string]string
 
-/*
-A dependency is a resource the source resource depends on.
-*/
-func (r *Resources) setNameToDeps() {
-	r.nameToDeps = make(nameToDeps)
-	for resourceName, packageJson := range r.nameToPackageJson {
-		var deps []string
-		// Loop over source resource's package.json deps
-		for dep := range packageJson.Dependencies {
-			internalDep, ok := r.packageJsonNameToName[dep]
-			// If package.json dep exists in map then it's an internal dep
-			if ok {
-				deps = append(deps, internalDep)
-			}
-		}
-		r.nameToDeps[resourceName] = deps
-	}
-}
-
-type nameToIndexFilePath map[string]string
-
-func (r *Resources) setNameToIndexFilePath() error {
-	r.nameToIndexFilePath = make(nameToIndexFilePath)
+func (r *Resources) setContainerSubdirPathToIndexFilePath() error {
+	r.containerSubdirPathToIndexFilePath = make(containerSubdirPathToIndexFilePath)
 
 	indexFilePathPattern := regexp.MustCompile(`^_[^.]+\.[^.]+\.[^.]+\.index\.ts$`)
 
 	for _, subdirPath := range r.containerSubdirPaths {
-		subdirName := filepath.Base(subdirPath)
-		snakeCaseResourceName := strings.ReplaceAll(subdirName, "-", "_")
-		screamingSnakeCaseResourceName := strings.ToUpper(snakeCaseResourceName)
-
 		srcPath := filepath.Join(subdirPath, "src")
 
 		files, err := os.ReadDir(srcPath)
@@ -304,7 +590,7 @@ func (r *Resources) setNameToIndexFilePath() error {
 
 		for _, file := range files {
 			if !file.IsDir() && indexFilePathPattern.MatchString(file.Name()) {
-				r.nameToIndexFilePath[screamingSnakeCaseResourceName] = filepath.Join(srcPath, file.Name())
+				r.containerSubdirPathToIndexFilePath[subdirPath] = filepath.Join(srcPath, file.Name())
 				break
 			}
 		}
@@ -313,126 +599,255 @@ func (r *Resources) setNameToIndexFilePath() error {
 	return nil
 }
 
-type nameToIndexFileContent map[string]string
+type nameToDeps map[string][]string
 
-func (r *Resources) setNameToIndexFileContent() error {
-	r.nameToIndexFileContent = make(nameToIndexFileContent)
-	for name, indexFilePath := range r.nameToIndexFilePath {
-		data, err := os.ReadFile(indexFilePath)
-		if err != nil {
-			return fmt.Errorf("unable to read file %s\n%v", indexFilePath, err)
+/*
+A dependency is a resource the source resource depends on.
+Deps are inferred from configs: a resource depends on the
+resources its config refers to (e.g. a worker's KV binding,
+which is usually the name of an imported KV config). They're
+merged with the deps declared in its package's package.json,
+so a resource also depends on every resource of the packages
+its package declares.
+
+A declared package none of the package's configs refer to is
+likely a leftover, so it's warned about.
+*/
+func (r *Resources) setNameToDeps() {
+	r.nameToDeps = make(nameToDeps)
+
+	subdirPathToUsedDepSubdirPaths := make(map[string][]string)
+
+	for name, config := range r.nameToConfig {
+		subdirPath := r.nameToContainerSubdirPath[name]
+
+		deps := make([]string, 0)
+		for _, ref := range configRefs(config) {
+			depSubdirPath, ok := r.nameToContainerSubdirPath[ref]
+			if !ok || ref == name {
+				continue
+			}
+			deps = append(deps, ref)
+			if !helpers.IsStringInSlice(subdirPathToUsedDepSubdirPaths[subdirPath], depSubdirPath) {
+				subdirPathToUsedDepSubdirPaths[subdirPath] = append(subdirPathToUsedDepSubdirPaths[subdirPath], depSubdirPath)
+			}
+		}
+
+		for _, depSubdirPath := range r.declaredDepSubdirPaths(subdirPath) {
+			for _, dep := range r.containerSubdirPathToNames[depSubdirPath] {
+				if !helpers.IsStringInSlice(deps, dep) {
+					deps = append(deps, dep)
+				}
+			}
+		}
+
+		sort.Strings(deps)
+		r.nameToDeps[name] = deps
+	}
+
+	subdirPaths := make([]string, 0, len(r.containerSubdirPathToNames))
+	for subdirPath := range r.containerSubdirPathToNames {
+		subdirPaths = append(subdirPaths, subdirPath)
+	}
+	sort.Strings(subdirPaths)
+
+	for _, subdirPath := range subdirPaths {
+		for _, depSubdirPath := range r.declaredDepSubdirPaths(subdirPath) {
+			isUsed := helpers.IsStringInSlice(subdirPathToUsedDepSubdirPaths[subdirPath], depSubdirPath)
+			if !isUsed && len(r.containerSubdirPathToNames[depSubdirPath]) > 0 {
+				fmt.Printf("Warning: %s depends on %s, but none of its configs refer to %s\n", filepath.Join(subdirPath, "package.json"), r.containerSubdirPathToPackageJson[depSubdirPath].Name, strings.Join(r.containerSubdirPathToNames[depSubdirPath], ", "))
+			}
 		}
-		r.nameToIndexFileContent[name] = string(data)
 	}
-	return nil
 }
 
-type nameToConfigData map[string]*configData
-
-type configData struct {
-	variableName string
-	functionName string
-	exportString string
-}
-
-func (r *Resources) setNameToConfigData() {
-	r.nameToConfigData = make(nameToConfigData)
-
-	for name, indexFileContent := range r.nameToIndexFileContent {
-		// Config setters are imported like this:
-		// import { cloudflareKv } from "@gasoline-dev/resources"
-		// They can be distinguished using a camelCase pattern.
-		configSetterFunctionNameRegex := regexp.MustCompile(`import\s+\{[^}]*\b([a-z]+[A-Z][a-zA-Z]*)\b[^}]*\}\s+from\s+['"]@gasoline-dev/resources['"]`)
-		// This can be limited to one match because there should only
-		// be one config setter per resource index file.
-		configSetterFunctionName := configSetterFunctionNameRegex.FindStringSubmatch(indexFileContent)[1]
-
-		// Configs are exported like this:
-		// export const coreBaseKv = cloudflareKv({
-		//   name: "CORE_BASE_KV",
-		// } as const)
-		exportedConfigRegex := regexp.MustCompile(`(?m)export\s+const\s+\w+\s*=\s*\w+\([\s\S]*?\)\s*(?:as\s*const\s*)?;?`)
-
-		// It can't be assumed that text that matches the exported config
-		// pattern is an exported config. A user can export non-configs
-		// using the same pattern above. So we need to collect possible
-		// exported configs and evaluate them later.
-		possibleExportedConfigs := exportedConfigRegex.FindAllString(indexFileContent, -1)
-
-		// This regex matches the variable name of an exported
-		// config. For example, it'd match "coreBaseKv" in:
-		// export const coreBaseKv = cloudflareKv({
-		//   name: "CORE_BASE_KV",
-		// } as const)
-		possibleExportedConfigVariableNameRegex := regexp.MustCompile(`export\s+const\s+(\w+)\s*=\s*\w+\(`)
-
-		// This regex matches the function name of an exported
-		// config. For example, it'd match "cloudflareKv" in:
-		// export const coreBaseKv = cloudflareKv({
-		//   name: "CORE_BASE_KV",
-		// } as const)
-		functionNameRegex := regexp.MustCompile(`\s*=\s*(\w+)\(`)
-
-		for _, possibleExportedConfig := range possibleExportedConfigs {
-			possibleExportedConfigFunctionName := functionNameRegex.FindStringSubmatch(possibleExportedConfig)[1]
-
-			// If possible exported config function name is equal to the
-			// config setter function name, then the possible exported
-			// config function name and possible exported config are
-			// confirmed to represent actual configs.
-			if possibleExportedConfigFunctionName == configSetterFunctionName {
-				r.nameToConfigData[name] = &configData{
-					variableName: possibleExportedConfigVariableNameRegex.FindStringSubmatch(possibleExportedConfig)[1],
-					functionName: possibleExportedConfigFunctionName,
-					exportString: possibleExportedConfig,
-				}
-				break
+/*
+Declared deps are the resource packages named in a package's
+dependencies, devDependencies or peerDependencies, whatever
+their version (e.g. workspace:*).
+*/
+func (r *Resources) declaredDepSubdirPaths(subdirPath string) []string {
+	packageJson := r.containerSubdirPathToPackageJson[subdirPath]
+
+	result := make([]string, 0)
+	for _, deps := range []map[string]string{packageJson.Dependencies, packageJson.DevDependencies, packageJson.PeerDependencies} {
+		for dep := range deps {
+			depSubdirPath, ok := r.packageJsonNameToContainerSubdirPath[dep]
+			if ok && depSubdirPath != subdirPath && !helpers.IsStringInSlice(result, depSubdirPath) {
+				result = append(result, depSubdirPath)
+			}
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+/*
+Configs refer to other resources by their config name (e.g.
+a worker's KV binding is the name of the KV's config) in the
+fields their type declares (see registerConfigRefs). Other
+string values (e.g. a worker's vars) aren't refs, even if
+they happen to name a resource. Refs are only deps if they
+name a resource.
+*/
+func configRefs(config interface{}) []string {
+	result := make([]string, 0)
+	for _, refs := range configRefFuncs[resourceTypeOf(config)] {
+		for _, ref := range refs(config) {
+			if ref != "" && !helpers.IsStringInSlice(result, ref) {
+				result = append(result, ref)
 			}
 		}
 	}
+
+	sort.Strings(result)
+	return result
 }
 
 type nodeJsConfigScript = string
 
-func (r *Resources) setNodeJsConfigScript() {
-	var functionNames []string
-
-	functionNameToTrue := make(map[string]bool)
-	for _, configData := range r.nameToConfigData {
-		functionNameToTrue[configData.functionName] = true
-		functionNames = append(functionNames, configData.functionName)
-	}
-
-	r.nodeJsConfigScript = "import {\n"
-	r.nodeJsConfigScript += strings.Join(functionNames, ",\n")
-	r.nodeJsConfigScript += "\n} "
-	r.nodeJsConfigScript += "from \"@gasoline-dev/resources\"\n"
-
-	// Configs have to be written in bottom-up dependency order to
-	// avoid Node.js "cannot access 'variable name' before
-	// initialization" errors. For example, given a graph of A->B,
-	// B's config has to be written before A's because A will
-	// reference B's config.
-	for group := range r.groupToDepthToNames {
-		numOfDepths := len(r.groupToDepthToNames[group])
-		for depth := numOfDepths; depth >= 0; depth-- {
-			for _, name := range r.groupToDepthToNames[group][depth] {
-				r.nodeJsConfigScript += strings.Replace(r.nameToConfigData[name].exportString, " as const", "", 1)
-				r.nodeJsConfigScript += "\n"
-			}
+/*
+Index files are bundled with esbuild so their imports (e.g.
+other resources' configs) resolve the same way they do when
+resources are built. The bundle's entry imports the index
+files of the given resource container subdirs (packages) and
+prints each one's exports that look like configs (objects
+with a type field):
+
+	{"gas/core-base-api":[{"exportName":"coreBaseApi","config":{...}}]}
+
+The result is printed after a marker line because evaluating
+an index file evaluates everything in it, which can log.
+*/
+func (r *Resources) bundleConfigScript(subdirPaths []string, format esbuild.Format, target esbuild.Target) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("unable to get working dir\n%v", err)
+	}
+
+	entry := ""
+	for i, subdirPath := range subdirPaths {
+		indexFilePath, err := filepath.Abs(r.containerSubdirPathToIndexFilePath[subdirPath])
+		if err != nil {
+			return "", fmt.Errorf("unable to resolve path of %s\n%v", r.containerSubdirPathToIndexFilePath[subdirPath], err)
 		}
+		entry += fmt.Sprintf("import * as package%d from %s;\n", i, strconv.Quote(filepath.ToSlash(indexFilePath)))
 	}
 
-	r.nodeJsConfigScript += "const resourceNameToConfig = {}\n"
+	entry += "const packageToModule = {\n"
+	for i, subdirPath := range subdirPaths {
+		entry += fmt.Sprintf("  %s: package%d,\n", strconv.Quote(subdirPath), i)
+	}
+	entry += "};\n"
+	entry += nodeJsConfigExportsScript
+
+	result := esbuild.Build(esbuild.BuildOptions{
+		Stdin: &esbuild.StdinOptions{
+			Contents:   entry,
+			ResolveDir: cwd,
+			Sourcefile: "gas-configs.js",
+			Loader:     esbuild.LoaderJS,
+		},
+		Bundle:   true,
+		Write:    false,
+		Format:   format,
+		Platform: esbuild.PlatformNode,
+		Target:   target,
+		LogLevel: esbuild.LogLevelSilent,
+		Plugins:  []esbuild.Plugin{cloudflareRuntimeModulesPlugin},
+	})
+
+	if len(result.Errors) > 0 {
+		messages := esbuild.FormatMessages(result.Errors, esbuild.FormatMessagesOptions{
+			Kind: esbuild.ErrorMessage,
+		})
+		return "", fmt.Errorf("unable to bundle resource index files\n%s", strings.TrimSpace(strings.Join(messages, "")))
+	}
+
+	return string(result.OutputFiles[0].Contents), nil
+}
 
-	for name, configData := range r.nameToConfigData {
-		r.nodeJsConfigScript += fmt.Sprintf("resourceNameToConfig[\"%s\"] = %s\n", name, configData.variableName)
+func (r *Resources) setNodeJsConfigScript() error {
+	script, err := r.bundleConfigScript(r.containerSubdirPathsWithIndexFile(), esbuild.FormatESModule, esbuild.ES2022)
+	if err != nil {
+		return err
 	}
 
-	r.nodeJsConfigScript += "console.log(JSON.stringify(resourceNameToConfig))\n"
+	r.nodeJsConfigScript = script
+
+	return nil
+}
+
+func (r *Resources) containerSubdirPathsWithIndexFile() []string {
+	result := make([]string, 0, len(r.containerSubdirPathToIndexFilePath))
+	for subdirPath := range r.containerSubdirPathToIndexFilePath {
+		result = append(result, subdirPath)
+	}
+	sort.Strings(result)
+	return result
+}
+
+const nodeJsConfigResultMarker = "__GAS_CONFIGS__"
+
+const nodeJsConfigExportsScript = `const packageToExportedConfigs = {};
+for (const [subdirPath, module] of Object.entries(packageToModule)) {
+  packageToExportedConfigs[subdirPath] = Object.entries(module)
+    .filter(([, value]) => value !== null && typeof value === "object" && typeof value.type === "string")
+    .map(([exportName, config]) => ({ exportName, config }));
+}
+console.log("\n` + nodeJsConfigResultMarker + `");
+console.log(JSON.stringify(packageToExportedConfigs));
+`
+
+/*
+Workers import runtime modules (e.g. DurableObject from
+cloudflare:workers) that don't exist in Node.js. They're
+swapped for stubs so index files can be evaluated.
+*/
+var cloudflareRuntimeModuleStubs = map[string]string{
+	"cloudflare:email": `export class EmailMessage {}
+`,
+	"cloudflare:sockets": `export function connect() {}
+`,
+	"cloudflare:workers": `export class DurableObject {}
+export class RpcStub {}
+export class RpcTarget {}
+export class WorkerEntrypoint {}
+export class WorkflowEntrypoint {}
+export const env = {};
+export function waitUntil() {}
+`,
+}
+
+var cloudflareRuntimeModulesPlugin = esbuild.Plugin{
+	Name: "cloudflare-runtime-modules",
+	Setup: func(build esbuild.PluginBuild) {
+		build.OnResolve(esbuild.OnResolveOptions{Filter: `^cloudflare:`}, func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+			return esbuild.OnResolveResult{
+				Path:      args.Path,
+				Namespace: "cloudflare-runtime",
+			}, nil
+		})
+		build.OnLoad(esbuild.OnLoadOptions{Filter: `.*`, Namespace: "cloudflare-runtime"}, func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+			contents, ok := cloudflareRuntimeModuleStubs[args.Path]
+			if !ok {
+				contents = "export default {};\n"
+			}
+			return esbuild.OnLoadResult{
+				Contents: &contents,
+				Loader:   esbuild.LoaderJS,
+			}, nil
+		})
+	},
 }
 
-type runNodeJsConfigScriptResult map[string]interface{}
+type runNodeJsConfigScriptResult map[string][]*exportedConfig
+
+type exportedConfig struct {
+	ExportName string                 `json:"exportName"`
+	Config     map[string]interface{} `json:"config"`
+}
 
 func (r *Resources) runNodeJsConfigScript() error {
 	cmd := exec.Command("node", "--input-type=module")
@@ -444,28 +859,139 @@ func (r *Resources) runNodeJsConfigScript() error {
 		return fmt.Errorf("unable to execute Node.js config script: %s\n%v", string(output), err)
 	}
 
-	strOutput := strings.TrimSpace(string(output))
-
-	err = json.Unmarshal([]byte(strOutput), &r.runNodeJsConfigScriptResult)
+	r.runNodeJsConfigScriptResult, err = parseConfigScriptOutput(string(output))
 	if err != nil {
-		return fmt.Errorf("unable to marshall Node.js config script result\n%v", err)
+		return err
 	}
 
 	return nil
 }
 
+func isNodeJsInstalled() bool {
+	_, err := exec.LookPath("node")
+	return err == nil
+}
+
+func parseConfigScriptOutput(output string) (runNodeJsConfigScriptResult, error) {
+	_, data, ok := strings.Cut(output, nodeJsConfigResultMarker+"\n")
+	if !ok {
+		return nil, fmt.Errorf("unable to find result in config script output: %s", output)
+	}
+
+	var result runNodeJsConfigScriptResult
+	err := json.Unmarshal([]byte(strings.TrimSpace(data)), &result)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshall config script result\n%v", err)
+	}
+
+	return result, nil
+}
+
 type nameToConfig = map[string]interface{}
 
-func (r *Resources) setNameToConfig() {
+type nameToContainerSubdirPath map[string]string
+
+type nameToIndexFilePath map[string]string
+
+type containerSubdirPathToNames map[string][]string
+
+type nameToConfigLocation map[string]string
+
+/*
+Every export of a package's index file whose type is a
+resource type is a resource, named by its config's name. A
+config has to match its type's schema (see configSchema) to
+be decoded. Problems are returned rather than stopping at
+the first, each prefixed with the location of the export
+it's in.
+
+Resources built from their package (e.g. workers) share the
+package's build, so a package should only have one of them.
+*/
+func (r *Resources) setNameToConfig() []string {
 	r.nameToConfig = make(nameToConfig)
-	for name, config := range r.runNodeJsConfigScriptResult {
-		c := config.(map[string]interface{})
-		resourceType := c["type"].(string)
-		r.nameToConfig[name] = configs[resourceType](config.(map[string]interface{}))
+	r.nameToConfigLocation = make(nameToConfigLocation)
+	r.nameToContainerSubdirPath = make(nameToContainerSubdirPath)
+	r.nameToIndexFilePath = make(nameToIndexFilePath)
+	r.containerSubdirPathToNames = make(containerSubdirPathToNames)
+
+	subdirPaths := make([]string, 0, len(r.runNodeJsConfigScriptResult))
+	for subdirPath := range r.runNodeJsConfigScriptResult {
+		subdirPaths = append(subdirPaths, subdirPath)
 	}
+	sort.Strings(subdirPaths)
+
+	result := make([]string, 0)
+
+	for _, subdirPath := range subdirPaths {
+		exports := r.runNodeJsConfigScriptResult[subdirPath]
+		indexFilePath := r.containerSubdirPathToIndexFilePath[subdirPath]
+
+		// The source is only read to find export lines, so a
+		// read error just leaves them out.
+		source, _ := os.ReadFile(indexFilePath)
+
+		if len(exports) == 0 {
+			result = append(result, fmt.Sprintf("%s: no config is exported (expected an exported object with a type field)", indexFilePath))
+			continue
+		}
+
+		for _, export := range exports {
+			resourceType := export.Config["type"].(string)
+			location := exportLocation(indexFilePath, string(source), export.ExportName)
+
+			if _, ok := configs[resourceType]; !ok {
+				result = append(result, fmt.Sprintf("%s: %s.type: unknown resource type %q", location, export.ExportName, resourceType))
+				continue
+			}
+
+			problems := configSchemaOf(resourceType).validate(export.ExportName, export.Config)
+			if len(problems) > 0 {
+				for _, problem := range problems {
+					result = append(result, location+": "+problem)
+				}
+				continue
+			}
+
+			name := export.Config["name"].(string)
+			if existing, ok := r.nameToConfigLocation[name]; ok {
+				result = append(result, fmt.Sprintf("%s: %s.name: %s is already the name of the config at %s", location, export.ExportName, name, existing))
+				continue
+			}
+
+			r.nameToConfig[name] = configs[resourceType](export.Config)
+			r.nameToConfigLocation[name] = location
+			r.nameToContainerSubdirPath[name] = subdirPath
+			r.nameToIndexFilePath[name] = indexFilePath
+			r.containerSubdirPathToNames[subdirPath] = append(r.containerSubdirPathToNames[subdirPath], name)
+		}
+	}
+
+	return result
+}
+
+/*
+path:line of an export's declaration, or just path when the
+declaration can't be found (e.g. it's re-exported from
+another module).
+*/
+func exportLocation(path string, source string, exportName string) string {
+	pattern := `export\s+(?:const|let|var|class|(?:async\s+)?function\*?)\s+` + regexp.QuoteMeta(exportName) + `\b|export\s*\{[^}]*\b` + regexp.QuoteMeta(exportName) + `\b[^}]*\}`
+	if exportName == "default" {
+		pattern = `export\s+default\b`
+	}
+
+	match := regexp.MustCompile(pattern).FindStringIndex(source)
+	if match == nil {
+		return path
+	}
+
+	return fmt.Sprintf("%s:%d", path, strings.Count(source[:match[0]], "\n")+1)
 }
 
-type upJson map[string]struct {
+type upJson map[string]*upJsonResource
+
+type upJsonResource struct {
 	Config       interface{} `json:"config"`
 	Dependencies []string    `json:"dependencies"`
 	Output       interface{} `json:"output"`
@@ -474,6 +1000,10 @@ type upJson map[string]struct {
 func (r *Resources) setUpJson() error {
 	r.upJson = make(upJson)
 
+	if r.isUpJsonOptional && !helpers.IsFilePresent(r.upJsonPath) {
+		return nil
+	}
+
 	data, err := os.ReadFile(r.upJsonPath)
 	if err != nil {
 		return fmt.Errorf("unable to read up .json file %s\n%v", r.upJsonPath, err)
@@ -503,38 +1033,93 @@ func (r *Resources) setUpNameToDeps() {
 
 type upNameToConfig map[string]interface{}
 
-func (r *Resources) setUpNameToConfig() upNameToConfig {
+/*
+The up .json file is only written by gas, but it's checked
+like a config is so a hand-edited or corrupt file points at
+the resource that's wrong instead of panicking.
+*/
+func (r *Resources) setUpNameToConfig() error {
 	r.upNameToConfig = make(upNameToConfig)
 	for name, data := range r.upJson {
-		config := data.Config.(map[string]interface{})
-		resourceType := config["type"].(string)
-		r.upNameToConfig[name] = configs[resourceType](config)
+		if data == nil {
+			return fmt.Errorf("invalid up .json file %s: %s: expected object, got null", r.upJsonPath, name)
+		}
+
+		config, ok := data.Config.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid up .json file %s: %s.config: expected object, got %s", r.upJsonPath, name, jsonTypeName(data.Config))
+		}
+
+		resourceType, ok := config["type"].(string)
+		if !ok {
+			return fmt.Errorf("invalid up .json file %s: %s.config.type: expected string, got %s", r.upJsonPath, name, jsonTypeName(config["type"]))
+		}
+
+		decode, ok := configs[resourceType]
+		if !ok {
+			return fmt.Errorf("invalid up .json file %s: %s.config.type: unknown resource type %q", r.upJsonPath, name, resourceType)
+		}
+
+		r.upNameToConfig[name] = decode(config)
 	}
-	return r.upNameToConfig
+	return nil
 }
 
 type upNameToOutput map[string]interface{}
 
-func (r *Resources) setUpNameToOutput() {
+func (r *Resources) setUpNameToOutput() error {
 	r.upNameToOutput = make(upNameToOutput)
 	for name, data := range r.upJson {
-		output := data.Output.(map[string]interface{})
-		r.upNameToOutput[name] = upOutputs["cloudflare-kv"](output)
+		if data.Output == nil {
+			continue
+		}
+
+		output, ok := data.Output.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid up .json file %s: %s.output: expected object, got %s", r.upJsonPath, name, jsonTypeName(data.Output))
+		}
+
+		resourceType := resourceTypeOf(r.upNameToConfig[name])
+		decode, ok := upOutputs[resourceType]
+		if !ok {
+			return fmt.Errorf("invalid up .json file %s: %s.output: resource type %q has no output", r.upJsonPath, name, resourceType)
+		}
+
+		r.upNameToOutput[name] = decode(output)
 	}
+	return nil
 }
 
-var upOutputs = map[string]func(output upOutput) interface{}{
-	"cloudflare-kv": func(output upOutput) interface{} {
-		return &CloudflareKvUpOutput{
-			ID: output["id"].(string),
-		}
-	},
+var upOutputs = make(map[string]func(output upOutput) interface{})
+
+func registerUpOutput(resourceType string, output func(output upOutput) interface{}) {
+	upOutputs[resourceType] = output
 }
 
 type upOutput map[string]interface{}
 
-type CloudflareKvUpOutput struct {
-	ID string `json:"id"`
+/*
+Decoded like outputs (see decodeUpOutput) so resource types
+with nested config fields don't have to assert each one.
+*/
+func decodeConfig(config config, pointer interface{}) interface{} {
+	data, err := json.Marshal(config)
+	if err == nil {
+		json.Unmarshal(data, pointer)
+	}
+	return pointer
+}
+
+/*
+Outputs are decoded by their JSON representation so each
+resource type only has to declare its output struct.
+*/
+func decodeUpOutput(output upOutput, pointer interface{}) interface{} {
+	data, err := json.Marshal(output)
+	if err == nil {
+		json.Unmarshal(data, pointer)
+	}
+	return pointer
 }
 
 /*
@@ -617,39 +1202,6 @@ func (r *Resources) setGroupToNames() {
 	}
 }
 
-type groupToHighestDeployDepth map[int]int
-
-func (r *Resources) setGroupToHighestDeployDepth() {
-	r.groupToHighestDeployDepth = make(groupToHighestDeployDepth)
-	for _, group := range r.groupsWithStateChanges {
-		deployDepth := 0
-		isFirstResourceToProcess := true
-		for _, name := range r.groupToNames[group] {
-			// UNCHANGED resources aren't deployed, so its depth
-			// can't be the deploy depth.
-			if r.nameToState[name] == stateType("UNCHANGED") {
-				continue
-			}
-
-			// If resource is first to make it this far set deploy
-			// depth so it can be used for comparison in future loops.
-			if isFirstResourceToProcess {
-				r.groupToHighestDeployDepth[group] = r.nameToDepth[name]
-				deployDepth = r.nameToDepth[name]
-				isFirstResourceToProcess = false
-				continue
-			}
-
-			// Update deploy depth if resource's depth is greater than
-			// the comparative deploy depth.
-			if r.nameToDepth[name] > deployDepth {
-				r.groupToHighestDeployDepth[group] = r.nameToDepth[name]
-				deployDepth = r.nameToDepth[name]
-			}
-		}
-	}
-}
-
 type nameToState map[string]stateType
 
 type stateType string
@@ -684,9 +1236,301 @@ func (r *Resources) setNameToState() {
 				continue
 			}
 
-			r.nameToState[name] = stateType(UNCHANGED)
+			if len(r.nameToPendingChanges[name]) > 0 {
+				r.nameToState[name] = stateType(UPDATED)
+				continue
+			}
+
+			r.nameToState[name] = stateType(UNCHANGED)
+		}
+	}
+}
+
+/*
+A replaced resource has a new output (e.g. a D1 database's
+ID), so its dependents are UPDATED to pick it up even if
+their configs didn't change. A dependent that's replaced
+itself as a result (e.g. its type has no UPDATED processor)
+has its dependents UPDATED too.
+*/
+func (r *Resources) setNameToStateOfReplacedDependents() {
+	replacedNames := make([]string, 0)
+	for name, state := range r.nameToState {
+		if state == stateType(UPDATED) && r.shouldReplace(name) {
+			replacedNames = append(replacedNames, name)
+		}
+	}
+	sort.Strings(replacedNames)
+
+	for len(replacedNames) > 0 {
+		name := replacedNames[0]
+		replacedNames = replacedNames[1:]
+
+		dependents := r.nameToDependents(name)
+		sort.Strings(dependents)
+
+		for _, dependent := range dependents {
+			if r.nameToState[dependent] != stateType(UNCHANGED) {
+				continue
+			}
+			r.nameToState[dependent] = stateType(UPDATED)
+			r.nameToPendingChanges[dependent] = append(r.nameToPendingChanges[dependent], name+" (replaced)")
+			if r.shouldReplace(dependent) {
+				replacedNames = append(replacedNames, dependent)
+			}
+		}
+	}
+}
+
+type nameToPendingChanges map[string][]string
+
+/*
+Pending changes are changes to a resource that aren't part
+of its config, such as new D1 migration files. Resource types
+that have them register a func that describes them by
+comparing the resource dir against the resource's up output.
+A resource type can register more than one. Changes that
+can't be worked out fail the plan rather than being guessed.
+*/
+type pendingChangesFunc func(dir string, config interface{}, upOutput interface{}) ([]string, error)
+
+var pendingChanges = make(map[string][]pendingChangesFunc)
+
+func registerPendingChanges(resourceType string, changes pendingChangesFunc) {
+	pendingChanges[resourceType] = append(pendingChanges[resourceType], changes)
+}
+
+/*
+Resources whose type changed are replaced, so their up output
+isn't compared against the current resource type's changes.
+*/
+func (r *Resources) setNameToPendingChanges() error {
+	r.nameToPendingChanges = make(nameToPendingChanges)
+	for name, config := range r.nameToConfig {
+		upOutput, ok := r.upNameToOutput[name]
+		if !ok || resourceTypeOf(r.upNameToConfig[name]) != resourceTypeOf(config) {
+			continue
+		}
+		for _, changes := range pendingChanges[resourceTypeOf(config)] {
+			result, err := changes(r.nameToContainerSubdirPath[name], config, upOutput)
+			if err != nil {
+				return fmt.Errorf("unable to get pending changes of %s\n%v", name, err)
+			}
+			r.nameToPendingChanges[name] = append(r.nameToPendingChanges[name], result...)
+		}
+	}
+	return nil
+}
+
+type nameToConfigChanges map[string][]configChange
+
+type configChange struct {
+	field string
+	from  interface{}
+	to    interface{}
+}
+
+/*
+Config changes are the top-level config fields that differ
+between an UPDATED resource's up config and current config.
+They determine whether the resource can be updated in place
+or has to be replaced (see shouldReplace).
+*/
+func (r *Resources) setNameToConfigChanges() {
+	r.nameToConfigChanges = make(nameToConfigChanges)
+	for name, state := range r.nameToState {
+		if state == stateType(UPDATED) {
+			r.nameToConfigChanges[name] = diffConfigs(r.upNameToConfig[name], r.nameToConfig[name])
+		}
+	}
+}
+
+func diffConfigs(from interface{}, to interface{}) []configChange {
+	fromFields := configToFields(from)
+	toFields := configToFields(to)
+
+	fields := make([]string, 0)
+	for field := range fromFields {
+		fields = append(fields, field)
+	}
+	for field := range toFields {
+		if _, ok := fromFields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	result := make([]configChange, 0)
+	for _, field := range fields {
+		if !reflect.DeepEqual(fromFields[field], toFields[field]) {
+			result = append(result, configChange{
+				field: field,
+				from:  fromFields[field],
+				to:    toFields[field],
+			})
+		}
+	}
+	return result
+}
+
+/*
+Changes to string list fields (e.g. crons) are logged as the
+items that were added and removed. ok is false if either
+value isn't a string list.
+*/
+func stringListChanges(from interface{}, to interface{}) (added []string, removed []string, ok bool) {
+	fromItems, ok := toStringList(from)
+	if !ok {
+		return nil, nil, false
+	}
+	toItems, ok := toStringList(to)
+	if !ok {
+		return nil, nil, false
+	}
+	for _, item := range toItems {
+		if !helpers.IsStringInSlice(fromItems, item) {
+			added = append(added, item)
+		}
+	}
+	for _, item := range fromItems {
+		if !helpers.IsStringInSlice(toItems, item) {
+			removed = append(removed, item)
+		}
+	}
+	return added, removed, true
+}
+
+func toStringList(value interface{}) ([]string, bool) {
+	if value == nil {
+		return make([]string, 0), true
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, s)
+	}
+	return result, true
+}
+
+/*
+Changes to object fields (e.g. vars) are logged per key. ok
+is false if either value isn't an object.
+*/
+func objectChanges(from interface{}, to interface{}) (fromObject map[string]interface{}, toObject map[string]interface{}, ok bool) {
+	fromObject, ok = toObjectValue(from)
+	if !ok {
+		return nil, nil, false
+	}
+	toObject, ok = toObjectValue(to)
+	if !ok {
+		return nil, nil, false
+	}
+	return fromObject, toObject, true
+}
+
+func toObjectValue(value interface{}) (map[string]interface{}, bool) {
+	if value == nil {
+		return make(map[string]interface{}), true
+	}
+	result, ok := value.(map[string]interface{})
+	return result, ok
+}
+
+func logObjectChanges(field string, from map[string]interface{}, to map[string]interface{}) {
+	keys := make([]string, 0, len(from)+len(to))
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fromValue, inFrom := from[key]
+		toValue, inTo := to[key]
+		fromData, _ := json.Marshal(fromValue)
+		toData, _ := json.Marshal(toValue)
+		switch {
+		case !inFrom:
+			fmt.Printf("  + %s.%s: %s\n", field, key, toData)
+		case !inTo:
+			fmt.Printf("  - %s.%s: %s\n", field, key, fromData)
+		case !reflect.DeepEqual(fromValue, toValue):
+			fmt.Printf("  ~ %s.%s: %s -> %s\n", field, key, fromData, toData)
+		}
+	}
+}
+
+/*
+Configs are compared by their JSON representation because
+that's what's written to, and read from, the up .json file.
+*/
+func configToFields(config interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	data, err := json.Marshal(config)
+	if err != nil {
+		return result
+	}
+	json.Unmarshal(data, &result)
+	return result
+}
+
+/*
+An UPDATED resource is replaced when its type changed, when
+its type has no UPDATED processor or when one of its type's
+replace fields changed.
+*/
+func (r *Resources) shouldReplace(name string) bool {
+	resourceType := r.nameToType(name)
+
+	if resourceTypeOf(r.upNameToConfig[name]) != resourceType {
+		return true
+	}
+
+	if _, ok := processorsNew[newProcessorKey(resourceType, UPDATED)]; !ok {
+		return true
+	}
+
+	for _, change := range r.nameToConfigChanges[name] {
+		// Resources can't be moved between accounts.
+		if change.field == "account" {
+			return true
+		}
+		if helpers.IsStringInSlice(replaceFields[resourceType], change.field) {
+			return true
 		}
 	}
+
+	return false
+}
+
+/*
+DELETED resources don't have a current config, so their
+type is read from their up config.
+*/
+func (r *Resources) nameToType(name string) string {
+	if config, ok := r.nameToConfig[name]; ok {
+		return resourceTypeOf(config)
+	}
+	return resourceTypeOf(r.upNameToConfig[name])
+}
+
+func resourceTypeOf(config interface{}) string {
+	return reflect.ValueOf(config).Elem().FieldByName("Type").String()
+}
+
+func resourceAccountOf(config interface{}) string {
+	return reflect.ValueOf(config).Elem().FieldByName("Account").String()
 }
 
 func (r *Resources) HasNamesToDeploy() bool {
@@ -711,36 +1555,118 @@ func (r *Resources) Deploy() error {
 		m: make(map[string]interface{}),
 	}
 
-	err := r.deployGroups()
+	r.undeletedReplacedNamesContainer = &undeletedReplacedNamesContainer{
+		m: make(map[string]bool),
+	}
+
+	deployErr := r.deployGroups()
+	if deployErr == nil {
+		deployErr = r.deployDeferredDeps()
+	}
+	if deployErr == nil {
+		deployErr = r.undeletedReplacedNamesContainer.err()
+	}
+
+	r.setNewUpJson()
+
+	err := r.writeUpJson()
 	if err != nil {
 		return err
 	}
 
-	newUpjson := make(upJson)
+	return deployErr
+}
+
+/*
+The new up .json file is a snapshot of what's deployed after
+the deploy finishes. UNCHANGED resources, and resources that
+failed or were canceled, keep their previous entries so a
+partial deploy doesn't lose track of anything in the cloud.
+*/
+func (r *Resources) setNewUpJson() {
+	r.newUpJson = make(upJson)
+	for name, state := range r.nameToState {
+		if state == stateType(UNCHANGED) {
+			r.newUpJson[name] = r.upJson[name]
+			continue
+		}
+
+		switch r.nameToDeployStateContainer.m[name] {
+		case deployState(CREATE_COMPLETE), deployState(UPDATE_COMPLETE):
+			output, ok := r.nameToDeployOutputContainer.get(name)
+			if !ok {
+				output = r.upNameToOutput[name]
+			}
+			r.newUpJson[name] = &upJsonResource{
+				Config:       r.nameToConfig[name],
+				Dependencies: r.nameToDeps[name],
+				Output:       output,
+			}
+			if r.undeletedReplacedNamesContainer.has(name) {
+				r.newUpJson[r.replacedUpName(name)] = r.upJson[name]
+			}
+		case deployState(DELETE_COMPLETE):
+			continue
+		case deployState(CREATE_FAILED), deployState(UPDATE_FAILED):
+			// Processors that fail part way through (e.g. after
+			// applying some D1 migrations) may have set an output
+			// that reflects what was deployed before the failure.
+			output, ok := r.nameToDeployOutputContainer.get(name)
+			if !ok {
+				if upResource, ok := r.upJson[name]; ok {
+					r.newUpJson[name] = upResource
+				}
+				continue
+			}
+			resource := &upJsonResource{
+				Config:       r.nameToConfig[name],
+				Dependencies: r.nameToDepsWithoutDeferred()[name],
+				Output:       output,
+			}
+			// A new resource that failed after being created (e.g.
+			// while attaching its deferred deps) is saved without its
+			// deferred deps so it's UPDATED on the next deploy.
+			if upResource, ok := r.upJson[name]; ok {
+				resource.Config = upResource.Config
+				resource.Dependencies = upResource.Dependencies
+			}
+			r.newUpJson[name] = resource
+		default:
+			if upJsonResource, ok := r.upJson[name]; ok {
+				r.newUpJson[name] = upJsonResource
+			}
+		}
+	}
+}
+
+/*
+A replaced resource that couldn't be deleted is kept in the
+up .json file under a name no config can have, so it's
+DELETED on the next deploy:
 
-	for resourceName, output := range r.nameToDeployOutputContainer.m {
-		newUpjson[resourceName] = struct {
-			Config       interface{} `json:"config"`
-			Dependencies []string    `json:"dependencies"`
-			Output       interface{} `json:"output"`
-		}{
-			Config:       r.nameToConfig[resourceName],
-			Dependencies: r.nameToDeps[resourceName],
-			Output:       output,
+	CORE_BASE_DB -> CORE_BASE_DB:replaced
+*/
+func (r *Resources) replacedUpName(name string) string {
+	result := name + ":replaced"
+	for i := 2; ; i++ {
+		_, inUpJson := r.upJson[result]
+		_, inNewUpJson := r.newUpJson[result]
+		if !inUpJson && !inNewUpJson {
+			return result
 		}
+		result = fmt.Sprintf("%s:replaced:%d", name, i)
 	}
+}
 
-	jsonData, err := json.MarshalIndent(newUpjson, "", "  ")
+func (r *Resources) writeUpJson() error {
+	data, err := json.MarshalIndent(r.newUpJson, "", "  ")
 	if err != nil {
-		fmt.Println("error marshalling to JSON:", err)
-		return nil
+		return fmt.Errorf("unable to marshall up .json file %s\n%v", r.upJsonPath, err)
 	}
 
-	fileName := "gas.up.json"
-	err = os.WriteFile(fileName, jsonData, 0644)
+	err = os.WriteFile(r.upJsonPath, data, 0644)
 	if err != nil {
-		fmt.Println("error writing to file:", err)
-		return nil
+		return fmt.Errorf("unable to write up .json file %s\n%v", r.upJsonPath, err)
 	}
 
 	return nil
@@ -760,8 +1686,48 @@ func (r *Resources) logNamePreDeployStates() {
 					name,
 					r.nameToState[name],
 				)
+				r.logNameConfigChanges(name)
+			}
+		}
+	}
+}
+
+func (r *Resources) logNameConfigChanges(name string) {
+	if r.nameToState[name] != stateType(UPDATED) {
+		return
+	}
+
+	if r.shouldReplace(name) {
+		fmt.Println("  (replace)")
+		// The warning is about what's lost, which is the
+		// replaced resource.
+		if warning, ok := replaceWarnings[resourceTypeOf(r.upNameToConfig[name])]; ok {
+			fmt.Printf("  ! warning: %s\n", warning)
+		}
+	}
+
+	for _, change := range r.nameToConfigChanges[name] {
+		// Reordered lists are logged like any other change.
+		if added, removed, ok := stringListChanges(change.from, change.to); ok && len(added)+len(removed) > 0 {
+			for _, item := range added {
+				fmt.Printf("  + %s: %s\n", change.field, item)
 			}
+			for _, item := range removed {
+				fmt.Printf("  - %s: %s\n", change.field, item)
+			}
+			continue
+		}
+		if fromObject, toObject, ok := objectChanges(change.from, change.to); ok {
+			logObjectChanges(change.field, fromObject, toObject)
+			continue
 		}
+		from, _ := json.Marshal(change.from)
+		to, _ := json.Marshal(change.to)
+		fmt.Printf("  ~ %s: %s -> %s\n", change.field, from, to)
+	}
+
+	for _, change := range r.nameToPendingChanges[name] {
+		fmt.Printf("  ~ %s\n", change)
 	}
 }
 
@@ -798,7 +1764,7 @@ func (r *Resources) logNameDeployState(name string, group int, depth int, timest
 		group,
 		depth,
 		name,
-		r.nameToDeployStateContainer.m[name],
+		r.getNameDeployState(name),
 	)
 }
 
@@ -851,15 +1817,76 @@ func (r *Resources) setNameToDeployStateOfPending() {
 	}
 }
 
-func (r *Resources) setNameToDeployStatePendingOfCanceled() int {
+/*
+Only the group's resources are canceled because each group
+counts its own resources to know when it's done (see
+deployGroup). Other groups keep deploying.
+*/
+func (r *Resources) setNameToDeployStatePendingOfCanceled(group int) int {
 	r.nameToDeployStateContainer.mu.Lock()
 	defer r.nameToDeployStateContainer.mu.Unlock()
 	result := 0
-	for name, state := range r.nameToDeployStateContainer.m {
-		if state == deployState(PENDING) {
+	for _, name := range r.groupToNames[group] {
+		if r.nameToDeployStateContainer.m[name] == deployState(PENDING) {
 			r.nameToDeployStateContainer.m[name] = deployState(CANCELED)
+			result++
+		}
+	}
+	return result
+}
+
+/*
+Resources with deferred deps that were deployed after them
+are deployed again as UPDATED so they pick up their deferred
+deps' outputs (e.g. a worker's service binding to a worker
+that didn't exist yet). Their own output from the first
+deploy is used as their up output, so nothing else changes.
+*/
+func (r *Resources) deployDeferredDeps() error {
+	names := make([]string, 0)
+	for name, deps := range r.nameToDeferredDeps {
+		state := r.getNameDeployState(name)
+		if state != deployState(CREATE_COMPLETE) && state != deployState(UPDATE_COMPLETE) {
+			continue
+		}
+		for _, dep := range deps {
+			if r.nameToState[dep] != stateType(UNCHANGED) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var result error
+	for _, name := range names {
+		r.nameToDeployStateContainer.mu.Lock()
+		r.nameToDeployStateContainer.m[name] = deployState(UPDATE_IN_PROGRESS)
+		r.nameToDeployStateContainer.mu.Unlock()
+
+		r.logNameDeployState(name, r.nameToGroup[name], r.nameToDepth[name], time.Now().UnixMilli())
+
+		params := r.newProcessorParams(name, make(processorOkChanType))
+		params.upConfig = params.config
+		if output, ok := r.nameToDeployOutputContainer.get(name); ok {
+			params.upOutput = output
+		}
+
+		go processorsNew[newProcessorKey(r.nameToType(name), UPDATED)](params)
+
+		state := deployState(UPDATE_COMPLETE)
+		if !<-params.processOkChan {
+			state = deployState(UPDATE_FAILED)
+			result = fmt.Errorf("deployment failed")
 		}
+
+		r.nameToDeployStateContainer.mu.Lock()
+		r.nameToDeployStateContainer.m[name] = state
+		r.nameToDeployStateContainer.mu.Unlock()
+
+		r.logNameDeployState(name, r.nameToGroup[name], r.nameToDepth[name], time.Now().UnixMilli())
 	}
+
 	return result
 }
 
@@ -900,16 +1927,10 @@ func (r *Resources) deployGroups() error {
 func (r *Resources) deployGroup(group int, deployGroupOkChan deployGroupOkChanType) {
 	deployNameOkChan := make(deployNameOkChanType)
 
-	highestGroupDeployDepth := r.groupToHighestDeployDepth[group]
-
-	initialGroupResourceNamesToDeploy := r.setInitGroupNamesToDeploy(
-		highestGroupDeployDepth,
-		group,
-	)
+	initialGroupResourceNamesToDeploy := r.setInitGroupNamesToDeploy(group)
 
 	for _, name := range initialGroupResourceNamesToDeploy {
-		depth := r.nameToDepth[name]
-		go r.deployName(name, deployNameOkChan, group, depth)
+		r.startDeployName(name, deployNameOkChan, group)
 	}
 
 	numOfNamesInGroupToDeploy := r.setNumInGroupToDeploy(
@@ -929,7 +1950,7 @@ func (r *Resources) deployGroup(group int, deployGroupOkChan deployGroupOkChanTy
 			// Check for 0 because resources should only
 			// be canceled one time.
 			if numOfNamesDeployedCanceled == 0 {
-				numOfNamesDeployedCanceled = r.setNameToDeployStatePendingOfCanceled()
+				numOfNamesDeployedCanceled = r.setNameToDeployStatePendingOfCanceled(group)
 			}
 		}
 
@@ -946,34 +1967,89 @@ func (r *Resources) deployGroup(group int, deployGroupOkChan deployGroupOkChanTy
 			return
 		} else {
 			for _, name := range r.groupToNames[group] {
-				if r.nameToDeployStateContainer.m[name] == deployState("PENDING") {
-					shouldDeployResource := true
-
-					// Is resource dependent on another deploying resource?
-					for _, dep := range r.nameToDeps[name] {
-						activeStates := map[deployState]bool{
-							deployState(CREATE_IN_PROGRESS): true,
-							deployState(DELETE_IN_PROGRESS): true,
-							deployState(PENDING):            true,
-							deployState(UPDATE_IN_PROGRESS): true,
-						}
+				if r.getNameDeployState(name) == deployState(PENDING) && r.isNameReadyToDeploy(name) {
+					r.startDeployName(name, deployNameOkChan, group)
+				}
+			}
+		}
+	}
+}
 
-						depDeployState := r.nameToDeployStateContainer.m[dep]
+/*
+A resource's deploy state is set to in progress before its
+deploy goroutine starts so it can't be started twice.
+*/
+func (r *Resources) startDeployName(name string, deployNameOkChan deployNameOkChanType, group int) {
+	r.setNameToDeployStateOfInProgress(name)
+	go r.deployName(name, deployNameOkChan, group, r.nameToDepth[name])
+}
 
-						if activeStates[depDeployState] {
-							shouldDeployResource = false
-							break
-						}
-					}
+func (r *Resources) getNameDeployState(name string) deployState {
+	r.nameToDeployStateContainer.mu.Lock()
+	defer r.nameToDeployStateContainer.mu.Unlock()
+	return r.nameToDeployStateContainer.m[name]
+}
 
-					if shouldDeployResource {
-						depth := r.nameToDepth[name]
-						go r.deployName(name, deployNameOkChan, group, depth)
-					}
-				}
+func (r *Resources) isNameDeployActive(name string) bool {
+	switch r.getNameDeployState(name) {
+	case deployState(CREATE_IN_PROGRESS),
+		deployState(DELETE_IN_PROGRESS),
+		deployState(PENDING),
+		deployState(UPDATE_IN_PROGRESS):
+		return true
+	}
+	return false
+}
+
+/*
+Resources are deployed after their deps, except DELETED
+resources, which are deployed after their dependents. A
+dependent has to stop using a resource (e.g. a worker
+removing a KV binding or a queue consumer) before the
+resource can be deleted.
+
+For example, given a graph of A->B where A is UPDATED and
+B is DELETED, A is deployed first, then B.
+*/
+func (r *Resources) isNameReadyToDeploy(name string) bool {
+	if r.nameToState[name] == stateType(DELETED) {
+		for _, dependent := range r.nameToDependents(name) {
+			if r.isNameDeployActive(dependent) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, dep := range r.nameToDeps[name] {
+		if r.nameToState[dep] == stateType(DELETED) || r.isDeferredDep(name, dep) {
+			continue
+		}
+		if r.isNameDeployActive(dep) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+Dependents are found using both current and up deps because
+a dependent may have stopped depending on a DELETED resource.
+*/
+func (r *Resources) nameToDependents(name string) []string {
+	result := make([]string, 0)
+	for _, nameToDeps := range []map[string][]string{r.nameToDeps, r.upNameToDeps} {
+		for dependent, deps := range nameToDeps {
+			if r.isDeferredDep(dependent, name) {
+				continue
+			}
+			if helpers.IsStringInSlice(deps, name) && !helpers.IsStringInSlice(result, dependent) {
+				result = append(result, dependent)
 			}
 		}
 	}
+	return result
 }
 
 type initGroupNamesToDeploy []string
@@ -995,36 +2071,17 @@ If just d and e need to be deployed, the deployment can't start
 at depth 3 only. e would be blocked until d finished because
 d has a higher depth than e. That's not optimal. They should
 be started at the same time and deployed concurrently.
+
+Therefore, every PENDING resource that's ready to deploy
+(see isNameReadyToDeploy) starts on deployment initiation.
 */
-func (r *Resources) setInitGroupNamesToDeploy(
-	highestDepthContainingAResourceToDeploy int,
-	group int,
-) initGroupNamesToDeploy {
+func (r *Resources) setInitGroupNamesToDeploy(group int) initGroupNamesToDeploy {
 	var result initGroupNamesToDeploy
-
-	// Add every resource at highest deploy depth containing
-	// a resource to deploy.
-	result = append(result, r.groupToDepthToNames[group][highestDepthContainingAResourceToDeploy]...)
-
-	// Check all other depths, except 0, for resources that can
-	// start deploying on deployment initiation (0 is skipped
-	// because a resource at that depth can only be deployed
-	// first if it's being deployed in isolation).
-	depthToCheck := highestDepthContainingAResourceToDeploy - 1
-	for depthToCheck > 0 {
-		for _, resourceNameAtDepthToCheck := range r.groupToDepthToNames[group][depthToCheck] {
-			for _, dependencyName := range r.nameToDeps[resourceNameAtDepthToCheck] {
-				// If resource at depth to check is PENDING and is not
-				// dependent on any resource in the ongoing result, then
-				// append it to the result.
-				if r.nameToDeployStateContainer.m[resourceNameAtDepthToCheck] == deployState(PENDING) && !helpers.IsStringInSlice(result, dependencyName) {
-					result = append(result, resourceNameAtDepthToCheck)
-				}
-			}
+	for _, name := range r.groupToNames[group] {
+		if r.getNameDeployState(name) == deployState(PENDING) && r.isNameReadyToDeploy(name) {
+			result = append(result, name)
 		}
-		depthToCheck--
 	}
-
 	return result
 }
 
@@ -1045,28 +2102,43 @@ type nameToDeployOutputContainer struct {
 	mu sync.Mutex
 }
 
-func (r *Resources) setNameToDeployOutput(name string, key processorKeyType, output interface{}) {
-	r.nameToDeployOutputContainer.mu.Lock()
-	defer r.nameToDeployOutputContainer.mu.Unlock()
-	r.nameToDeployOutputContainer.m[name] = resourceDeployOutputs[key](output)
+/*
+Processors set the output of the resource they deployed
+using the processor's key to convert the API response into
+the resource type's output.
+*/
+func (c *nameToDeployOutputContainer) set(name string, key processorKeyType, output interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[name] = resourceDeployOutputs[key](output)
+}
+
+func (c *nameToDeployOutputContainer) get(name string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	output, ok := c.m[name]
+	return output, ok
 }
 
 type deployNameOkChanType chan bool
 
 func (r *Resources) deployName(name string, deployNameOkChan deployNameOkChanType, group int, depth int) {
-	r.setNameToDeployStateOfInProgress(name)
-
 	timestamp := time.Now().UnixMilli()
 
 	r.logNameDeployState(name, group, depth, timestamp)
 
 	processorOkChan := make(processorOkChanType)
 
-	resourceType := reflect.ValueOf(r.nameToConfig[name]).Elem().FieldByName("Type").String()
+	resourceType := r.nameToType(name)
 
-	processorKey := processorKeyType(resourceType + ":" + string(r.nameToState[name]))
+	params := r.newProcessorParams(name, processorOkChan)
 
-	go processorsNew[processorKey](r.nameToConfig[name], processorOkChan, r.nameToDeployOutputContainer, r.upNameToOutput[name])
+	if r.nameToState[name] == stateType(UPDATED) && r.shouldReplace(name) {
+		go r.replaceName(params, resourceType)
+	} else {
+		processorKey := newProcessorKey(resourceType, r.nameToState[name])
+		go processorsNew[processorKey](params)
+	}
 
 	if <-processorOkChan {
 		r.setNameToDeployStateOfComplete(name)
@@ -1089,127 +2161,321 @@ func (r *Resources) deployName(name string, deployNameOkChan deployNameOkChanTyp
 	deployNameOkChan <- false
 }
 
-type processorsType map[processorKeyType]func(
-	config interface{},
-	processOkChan processorOkChanType,
-	deployOutput *nameToDeployOutputContainer,
-	upOutput interface{},
-)
+/*
+Replacing a resource creates the new resource before deleting
+the old one so dependents are never left without it. The new
+resource's output is set by its create, and the old one's
+stays in the up output.
+
+If the old one can't be deleted (e.g. a bucket that isn't
+empty), the new one is still deployed so dependents move to
+it. The old one is kept in the up .json file to be deleted on
+the next deploy (see replacedUpName), and the deploy fails.
+*/
+func (r *Resources) replaceName(params *processorParams, resourceType string) {
+	createParams := *params
+	createParams.upConfig = nil
+	createParams.upOutput = nil
+	createParams.processOkChan = make(processorOkChanType)
+	go processorsNew[newProcessorKey(resourceType, CREATED)](&createParams)
+	if !<-createParams.processOkChan {
+		params.processOkChan <- false
+		return
+	}
 
-type processorOkChanType = chan bool
+	// The replaced resource is deleted as the type it was
+	// deployed as, which differs if the config's type changed.
+	deleteParams := *params
+	deleteParams.config = params.upConfig
+	deleteParams.processOkChan = make(processorOkChanType)
+	go processorsNew[newProcessorKey(resourceTypeOf(params.upConfig), DELETED)](&deleteParams)
+	if !<-deleteParams.processOkChan {
+		r.undeletedReplacedNamesContainer.add(params.name)
+	}
 
-type processorKeyType string
+	params.processOkChan <- true
+}
 
-const (
-	CLOUDFLARE_KV_CREATED processorKeyType = "cloudflare-kv:CREATED"
-	CLOUDFLARE_KV_DELETED processorKeyType = "cloudflare-kv:DELETED"
-)
+type undeletedReplacedNamesContainer struct {
+	m  map[string]bool
+	mu sync.Mutex
+}
 
-// TODO: Think about changing into a register pattern like monkey
-var processorsNew processorsType = processorsType{
-	CLOUDFLARE_KV_CREATED: func(
-		config interface{},
-		processOkChan processorOkChanType,
-		deployOutput *nameToDeployOutputContainer,
-		upOutput interface{},
-	) {
-		c := config.(*CloudflareKVConfig)
-
-		api, err := cloudflare.NewWithAPIToken(os.Getenv("CLOUDFLARE_API_TOKEN"))
-		if err != nil {
-			fmt.Println("Error:", err)
-			processOkChan <- false
-			return
-		}
+func (c *undeletedReplacedNamesContainer) add(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[name] = true
+}
 
-		title := viper.GetString("project") + "-" + helpers.CapitalSnakeCaseToTrainCase(c.Name)
+func (c *undeletedReplacedNamesContainer) has(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.m[name]
+}
 
-		req := cloudflare.CreateWorkersKVNamespaceParams{Title: title}
+func (c *undeletedReplacedNamesContainer) err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.m) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(c.m))
+	for name := range c.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("deployment failed, unable to delete the replaced resources of %s (they'll be deleted on the next deploy)", strings.Join(names, ", "))
+}
 
-		res, err := api.CreateWorkersKVNamespace(context.Background(), cloudflare.AccountIdentifier(os.Getenv("CLOUDFLARE_ACCOUNT_ID")), req)
+type processorsType map[processorKeyType]processor
 
-		if err != nil {
-			fmt.Println("Error:", err)
-			processOkChan <- false
-			return
-		}
+type processor func(p *processorParams)
 
-		// TODO: THIS NEEDS TO BE FIXED
-		//deployOutput.setNameToDeployOutput()
-		// deployOutput.set(c.Name, CLOUDFLARE_KV_CREATED, res)
+/*
+Processor params are everything a processor needs to deploy
+a resource. Dep outputs are the outputs of the resource's deps
+as they are after the deps finished deploying (or as they are
+in the up .json file if the deps didn't need deploying).
+*/
+type processorParams struct {
+	name            string
+	dir             string
+	config          interface{}
+	upConfig        interface{}
+	upOutput        interface{}
+	depNameToConfig map[string]interface{}
+	depNameToOutput map[string]interface{}
+	deferredDeps    []string
+	deployOutput    *nameToDeployOutputContainer
+	processOkChan   processorOkChanType
+}
 
-		fmt.Println(res)
+/*
+Processors of UPDATED and DELETED resources need the
+resource's up output, which is missing if the up .json file
+was edited by hand.
+*/
+func (p *processorParams) upOutputErr() error {
+	return fmt.Errorf("unable to find up output of %s in up .json file", p.name)
+}
 
-		processOkChan <- true
-	},
-	CLOUDFLARE_KV_DELETED: func(
-		config interface{},
-		processOkChan processorOkChanType,
-		deployOutput *nameToDeployOutputContainer,
-		upOutput interface{},
-	) {
-		uo := upOutput.(*CloudflareKvUpOutput)
-
-		api, err := cloudflare.NewWithAPIToken(os.Getenv("CLOUDFLARE_API_TOKEN"))
-		if err != nil {
-			fmt.Println("Error:", err)
-			processOkChan <- false
-			return
-		}
+func (p *processorParams) upConfigErr() error {
+	return fmt.Errorf("unable to find up config of %s in up .json file", p.name)
+}
 
-		res, err := api.DeleteWorkersKVNamespace(context.Background(), cloudflare.AccountIdentifier(os.Getenv("CLOUDFLARE_ACCOUNT_ID")), uo.ID)
+func (r *Resources) newProcessorParams(name string, processOkChan processorOkChanType) *processorParams {
+	params := &processorParams{
+		name:            name,
+		dir:             r.nameToContainerSubdirPath[name],
+		config:          r.nameToConfig[name],
+		upConfig:        r.upNameToConfig[name],
+		upOutput:        r.upNameToOutput[name],
+		depNameToConfig: make(map[string]interface{}),
+		depNameToOutput: make(map[string]interface{}),
+		deferredDeps:    r.nameToDeferredDeps[name],
+		deployOutput:    r.nameToDeployOutputContainer,
+		processOkChan:   processOkChan,
+	}
 
-		fmt.Println(res)
+	// Up deps are included because a resource may still have to
+	// stop using a dep it no longer depends on (e.g. a worker
+	// removing a queue consumer).
+	deps := append(make([]string, 0), r.nameToDeps[name]...)
+	for _, dep := range r.upNameToDeps[name] {
+		if !helpers.IsStringInSlice(deps, dep) {
+			deps = append(deps, dep)
+		}
+	}
 
-		if err != nil {
-			fmt.Println("Error:", err)
-			processOkChan <- false
-			return
+	for _, dep := range deps {
+		if config, ok := r.nameToConfig[dep]; ok {
+			params.depNameToConfig[dep] = config
+		} else if config, ok := r.upNameToConfig[dep]; ok {
+			params.depNameToConfig[dep] = config
 		}
 
-		processOkChan <- true
-	},
+		if output, ok := r.nameToDeployOutputContainer.get(dep); ok {
+			params.depNameToOutput[dep] = output
+		} else if output, ok := r.upNameToOutput[dep]; ok {
+			params.depNameToOutput[dep] = output
+		}
+	}
+
+	return params
+}
+
+/*
+A deferred dep that hasn't been deployed yet has no output.
+Processors that can do without it (see registerDeferrableDep)
+check for this error.
+*/
+var errDeferredDepNotDeployed = errors.New("deferred dependency is not deployed yet")
+
+/*
+DELETED resources don't have a current config, so their
+account is read from their up config.
+*/
+func (p *processorParams) account() string {
+	if p.config != nil {
+		return resourceAccountOf(p.config)
+	}
+	return resourceAccountOf(p.upConfig)
 }
 
-var configs = map[string]func(config config) interface{}{
-	"cloudflare-kv": func(config config) interface{} {
-		return &CloudflareKVConfig{
-			ConfigCommon: ConfigCommon{
-				Type: config["type"].(string),
-				Name: config["name"].(string),
-			},
+/*
+Dependents reference their deps by config name. For example,
+a worker's KV binding is the name of the KV resource it
+depends on. The output is checked to be of the dep's resource
+type, so callers can assert it.
+*/
+func (p *processorParams) depOutputByConfigName(resourceType string, configName string) (interface{}, error) {
+	for dep, config := range p.depNameToConfig {
+		c := reflect.ValueOf(config).Elem()
+		if c.FieldByName("Type").String() != resourceType || c.FieldByName("Name").String() != configName {
+			continue
 		}
-	},
+
+		output, ok := p.depNameToOutput[dep]
+		if !ok {
+			if helpers.IsStringInSlice(p.deferredDeps, dep) {
+				return nil, errDeferredDepNotDeployed
+			}
+			return nil, fmt.Errorf("%s dependency %s has no output", resourceType, configName)
+		}
+
+		if reflect.TypeOf(output) != reflect.TypeOf(upOutputs[resourceType](upOutput{})) {
+			return nil, fmt.Errorf("%s dependency %s has an output of another resource type", resourceType, configName)
+		}
+
+		return output, nil
+	}
+
+	return nil, fmt.Errorf("unable to find %s dependency %s", resourceType, configName)
+}
+
+type processorOkChanType = chan bool
+
+type processorKeyType string
+
+func newProcessorKey(resourceType string, state stateType) processorKeyType {
+	return processorKeyType(resourceType + ":" + string(state))
+}
+
+var processorsNew = make(processorsType)
+
+/*
+Resource types register their processors, config decoders,
+and outputs in init funcs of their own files. This keeps
+the deploy engine ignorant of any specific resource type.
+*/
+func registerProcessor(key processorKeyType, processor processor) {
+	processorsNew[key] = processor
+}
+
+var configs = make(map[string]func(config config) interface{})
+
+func registerConfig(resourceType string, decoder func(config config) interface{}) {
+	configs[resourceType] = decoder
 }
 
 type config map[string]interface{}
 
+/*
+Names are CAPITAL_SNAKE_CASE (e.g. CORE_BASE_KV). ID is the
+ID of the template a resource was added from (e.g.
+core:base:cloudflare-kv:v1:12345) and isn't deployed. Account
+is the name of the account the resource is deployed to (see
+cloudflareAccountConfig). It's empty for the default account.
+*/
 type ConfigCommon struct {
-	Type string `json:"type"`
-	Name string `json:"name"`
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name" schema:"pattern=^[A-Z][A-Z0-9]*(_[A-Z0-9]+)*$"`
+	Account string `json:"account,omitempty"`
 }
 
-type CloudflareKVConfig struct {
-	ConfigCommon
+var resourceDeployOutputs = make(map[processorKeyType]func(output interface{}) interface{})
+
+func registerDeployOutput(key processorKeyType, output func(output interface{}) interface{}) {
+	resourceDeployOutputs[key] = output
 }
 
-type CloudflareWorkerConfig struct {
-	ConfigCommon
-	KV []struct {
-		Binding string `json:"binding"`
-	} `json:"kv"`
+/*
+Replace fields are config fields that can't be updated in
+place. Changing one of them causes the resource to be
+replaced (the new resource is created, then the old one
+is deleted).
+
+Resource types without an UPDATED processor are always
+replaced when they're UPDATED.
+*/
+var replaceFields = make(map[string][]string)
+
+func registerReplaceFields(resourceType string, fields ...string) {
+	replaceFields[resourceType] = append(replaceFields[resourceType], fields...)
 }
 
-var resourceDeployOutputs = map[processorKeyType]func(output interface{}) interface{}{
-	CLOUDFLARE_KV_CREATED: func(res interface{}) interface{} {
-		r := res.(cloudflare.WorkersKVNamespaceResponse)
+/*
+Replace warnings are logged with the plan when a resource
+of the type is going to be replaced (e.g. because its data
+won't be carried over).
+*/
+var replaceWarnings = make(map[string]string)
 
-		return &CloudflareKVOutput{
-			ID: r.Result.ID,
-		}
-	},
+func registerReplaceWarning(resourceType string, warning string) {
+	replaceWarnings[resourceType] = warning
+}
+
+/*
+Deferrable deps are deps a resource can be deployed without
+when they're part of a dependency cycle (see
+setNameToDeferredDeps).
+*/
+var deferrableDeps = make(map[string][]func(config interface{}, depConfig interface{}) bool)
+
+func registerDeferrableDep(resourceType string, isDeferrable func(config interface{}, depConfig interface{}) bool) {
+	deferrableDeps[resourceType] = append(deferrableDeps[resourceType], isDeferrable)
+}
+
+/*
+Config ref funcs return the config names a config refers to
+other resources by (see configRefs).
+*/
+var configRefFuncs = make(map[string][]func(config interface{}) []string)
+
+func registerConfigRefs(resourceType string, refs func(config interface{}) []string) {
+	configRefFuncs[resourceType] = append(configRefFuncs[resourceType], refs)
+}
+
+/*
+Stage config appliers merge a stage's overrides from
+gas.config.json (see stageConfig) into a resource's config.
+*/
+var stageConfigs = make(map[string][]func(config interface{}, stage *stageConfig) error)
+
+func registerStageConfig(resourceType string, apply func(config interface{}, stage *stageConfig) error) {
+	stageConfigs[resourceType] = append(stageConfigs[resourceType], apply)
 }
 
-type CloudflareKVOutput struct {
-	ID string `json:"id"`
+/*
+Permissions are the API token permissions deploying a config
+of the type needs (see checkCloudflareTokenPermissions). The
+state is what's being done with the config: CREATED, UPDATED
+or DELETED.
+*/
+var resourcePermissions = make(map[string][]func(config interface{}, state stateType) []string)
+
+func registerPermissions(resourceType string, permissions func(config interface{}, state stateType) []string) {
+	resourcePermissions[resourceType] = append(resourcePermissions[resourceType], permissions)
+}
+
+/*
+Validators check a resource's config before anything is
+deployed, so mistakes are caught at plan time rather than
+part way through a deploy.
+*/
+var validators = make(map[string][]func(config interface{}) error)
+
+func registerValidator(resourceType string, validator func(config interface{}) error) {
+	validators[resourceType] = append(validators[resourceType], validator)
 }
@@ -0,0 +1,919 @@
+package resources
+
+import (
+	"gas/helpers"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+Plans resources from the configs each container subdir path
+exports, as InitWithUp does once configs are evaluated.
+*/
+func newTestResources(t *testing.T, upJsonPath string, subdirPathToExports map[string][]*exportedConfig) *Resources {
+	t.Helper()
+
+	r := New()
+	r.upJsonPath = upJsonPath
+	planTestResources(t, r, subdirPathToExports)
+	return r
+}
+
+func planTestResources(t *testing.T, r *Resources, subdirPathToExports map[string][]*exportedConfig) {
+	t.Helper()
+
+	r.containerSubdirPathToPackageJson = make(containerSubdirPathToPackageJson)
+	r.containerSubdirPathToIndexFilePath = make(containerSubdirPathToIndexFilePath)
+	r.runNodeJsConfigScriptResult = make(runNodeJsConfigScriptResult)
+
+	for subdirPath, exports := range subdirPathToExports {
+		r.containerSubdirPathToPackageJson[subdirPath] = &packageJson{Name: filepath.Base(subdirPath)}
+		r.containerSubdirPathToIndexFilePath[subdirPath] = filepath.Join(subdirPath, "src", "index.ts")
+		r.runNodeJsConfigScriptResult[subdirPath] = exports
+	}
+
+	problems := r.setNameToConfig()
+	if len(problems) > 0 {
+		t.Fatal(strings.Join(problems, "\n"))
+	}
+	r.setNameToDeps()
+
+	err := r.setUpJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.setUpNameToConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.setUpNameToDeps()
+	err = r.setUpNameToOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.nameToDeps = helpers.MergeStringSliceMaps(r.upNameToDeps, r.nameToDeps)
+	err = r.setNameToPendingChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.setNameToState()
+	r.setNameToConfigChanges()
+	r.setNameToStateOfReplacedDependents()
+}
+
+/*
+Groups planned resources, as InitWithUp does once states are
+known, so they can be deployed with Deploy.
+*/
+func groupTestResources(t *testing.T, r *Resources) {
+	t.Helper()
+
+	err := r.setNameToDeferredDeps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.setGraph(r.nameToDepsWithoutDeferred())
+	r.setNameToGroup()
+	r.setGroupsWithStateChanges()
+	r.setGroupToNames()
+}
+
+/*
+Replaces a processor for the duration of a test so resources
+are deployed without calling the Cloudflare API.
+*/
+func setTestProcessor(t *testing.T, key processorKeyType, processor processor) {
+	t.Helper()
+
+	existing := processorsNew[key]
+	t.Cleanup(func() {
+		processorsNew[key] = existing
+	})
+	processorsNew[key] = processor
+}
+
+/*
+Deploys every resource that isn't UNCHANGED and writes the up
+.json file, as a deploy that succeeds does.
+*/
+func deployTestResources(t *testing.T, r *Resources, nameToOutput map[string]interface{}) {
+	t.Helper()
+
+	r.nameToDeployStateContainer = &nameToDeployStateContainer{m: make(map[string]deployState)}
+	r.nameToDeployOutputContainer = &nameToDeployOutputContainer{m: make(map[string]interface{})}
+	r.undeletedReplacedNamesContainer = &undeletedReplacedNamesContainer{m: make(map[string]bool)}
+	for name, state := range r.nameToState {
+		switch state {
+		case stateType(CREATED):
+			r.nameToDeployStateContainer.m[name] = deployState(CREATE_COMPLETE)
+			r.nameToDeployOutputContainer.m[name] = nameToOutput[name]
+		case stateType(UPDATED):
+			r.nameToDeployStateContainer.m[name] = deployState(UPDATE_COMPLETE)
+			r.nameToDeployOutputContainer.m[name] = nameToOutput[name]
+		case stateType(DELETED):
+			r.nameToDeployStateContainer.m[name] = deployState(DELETE_COMPLETE)
+		}
+	}
+
+	r.setNewUpJson()
+	err := r.writeUpJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+/*
+Returns what f prints, for checking what plans log.
+*/
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	outputChan := make(chan string)
+	go func() {
+		output, _ := io.ReadAll(reader)
+		outputChan <- string(output)
+	}()
+
+	f()
+
+	writer.Close()
+	return <-outputChan
+}
+
+func newTestUpJsonPath(t *testing.T, upJson string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "gas.up.json")
+	err := os.WriteFile(path, []byte(upJson), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var testKvExports = map[string][]*exportedConfig{
+	"gas/core-base-kv": {
+		{ExportName: "coreBaseKv", Config: config{"type": "cloudflare-kv", "name": "CORE_BASE_KV"}},
+	},
+}
+
+var testDnsExports = map[string][]*exportedConfig{
+	"gas/core-base-zone": {
+		{ExportName: "coreBaseZone", Config: config{"type": "cloudflare-dns-zone", "name": "CORE_BASE_ZONE", "domain": "example.com"}},
+	},
+	"gas/core-base-record": {
+		{ExportName: "coreBaseRecord", Config: config{"type": "cloudflare-dns-record", "name": "CORE_BASE_RECORD", "zone": "CORE_BASE_ZONE", "recordType": "A", "recordName": "www", "content": "192.0.2.1"}},
+	},
+}
+
+var testDnsOutputs = map[string]interface{}{
+	"CORE_BASE_ZONE":   &CloudflareDnsZoneOutput{ID: "zone-id", Domain: "example.com", NameServers: []string{}},
+	"CORE_BASE_RECORD": &CloudflareDnsRecordOutput{ID: "record-id", ZoneID: "zone-id"},
+}
+
+func TestRedeployWithoutChangesIsUnchanged(t *testing.T) {
+	tests := []struct {
+		name                string
+		subdirPathToExports map[string][]*exportedConfig
+		nameToOutput        map[string]interface{}
+	}{
+		{
+			name:                "resource without deps",
+			subdirPathToExports: testKvExports,
+			nameToOutput: map[string]interface{}{
+				"CORE_BASE_KV": &CloudflareKVOutput{ID: "kv-id"},
+			},
+		},
+		{
+			name:                "resources with and without deps",
+			subdirPathToExports: testDnsExports,
+			nameToOutput:        testDnsOutputs,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upJsonPath := newTestUpJsonPath(t, "{}")
+
+			first := newTestResources(t, upJsonPath, tt.subdirPathToExports)
+			for name, state := range first.nameToState {
+				if state != stateType(CREATED) {
+					t.Fatalf("first deploy: %s is %s, expected CREATED", name, state)
+				}
+			}
+			deployTestResources(t, first, tt.nameToOutput)
+
+			second := newTestResources(t, upJsonPath, tt.subdirPathToExports)
+			if len(second.nameToState) != len(first.nameToState) {
+				t.Fatalf("redeploy: got %d resources, expected %d", len(second.nameToState), len(first.nameToState))
+			}
+			for name, state := range second.nameToState {
+				if state != stateType(UNCHANGED) {
+					t.Errorf("redeploy: %s is %s, expected UNCHANGED", name, state)
+				}
+			}
+		})
+	}
+}
+
+/*
+Resources are named by their configs' names, so renaming a
+config deletes the resource with the old name and creates
+one with the new name.
+*/
+func TestConfigNameChangeReplacesResource(t *testing.T) {
+	upJsonPath := newTestUpJsonPath(t, "{}")
+
+	deployTestResources(t, newTestResources(t, upJsonPath, testKvExports), map[string]interface{}{
+		"CORE_BASE_KV": &CloudflareKVOutput{ID: "kv-id"},
+	})
+
+	renamed := newTestResources(t, upJsonPath, map[string][]*exportedConfig{
+		"gas/core-base-kv": {
+			{ExportName: "coreBaseKv", Config: config{"type": "cloudflare-kv", "name": "CORE_BASE_CACHE"}},
+		},
+	})
+
+	expected := nameToState{
+		"CORE_BASE_KV":    stateType(DELETED),
+		"CORE_BASE_CACHE": stateType(CREATED),
+	}
+	if !reflect.DeepEqual(renamed.nameToState, expected) {
+		t.Errorf("got states %v, expected %v", renamed.nameToState, expected)
+	}
+}
+
+/*
+Dependents of a replaced resource are redeployed so they
+pick up its new output, even though their configs didn't
+change.
+*/
+func TestReplacedResourceUpdatesDependents(t *testing.T) {
+	upJsonPath := newTestUpJsonPath(t, "{}")
+
+	deployTestResources(t, newTestResources(t, upJsonPath, testDnsExports), testDnsOutputs)
+
+	r := newTestResources(t, upJsonPath, map[string][]*exportedConfig{
+		"gas/core-base-zone": {
+			{ExportName: "coreBaseZone", Config: config{"type": "cloudflare-dns-zone", "name": "CORE_BASE_ZONE", "domain": "example.org"}},
+		},
+		"gas/core-base-record": testDnsExports["gas/core-base-record"],
+	})
+
+	expected := nameToState{
+		"CORE_BASE_ZONE":   stateType(UPDATED),
+		"CORE_BASE_RECORD": stateType(UPDATED),
+	}
+	if !reflect.DeepEqual(r.nameToState, expected) {
+		t.Fatalf("got states %v, expected %v", r.nameToState, expected)
+	}
+	if !r.shouldReplace("CORE_BASE_ZONE") {
+		t.Error("expected CORE_BASE_ZONE to be replaced")
+	}
+	if r.shouldReplace("CORE_BASE_RECORD") {
+		t.Error("expected CORE_BASE_RECORD to be updated in place")
+	}
+	if !reflect.DeepEqual(r.nameToPendingChanges["CORE_BASE_RECORD"], []string{"CORE_BASE_ZONE (replaced)"}) {
+		t.Errorf("got pending changes %v, expected CORE_BASE_ZONE (replaced)", r.nameToPendingChanges["CORE_BASE_RECORD"])
+	}
+}
+
+func TestInvalidUpJsonIsLocated(t *testing.T) {
+	tests := []struct {
+		name   string
+		upJson string
+		err    string
+	}{
+		{
+			name:   "null resource",
+			upJson: `{"CORE_BASE_KV": null}`,
+			err:    "CORE_BASE_KV: expected object, got null",
+		},
+		{
+			name:   "config isn't an object",
+			upJson: `{"CORE_BASE_KV": {"config": "kv", "dependencies": [], "output": null}}`,
+			err:    "CORE_BASE_KV.config: expected object, got string",
+		},
+		{
+			name:   "missing type",
+			upJson: `{"CORE_BASE_KV": {"config": {"name": "CORE_BASE_KV"}, "dependencies": [], "output": null}}`,
+			err:    "CORE_BASE_KV.config.type: expected string, got null",
+		},
+		{
+			name:   "unknown type",
+			upJson: `{"CORE_BASE_KV": {"config": {"type": "cloudflare-kb", "name": "CORE_BASE_KV"}, "dependencies": [], "output": null}}`,
+			err:    `CORE_BASE_KV.config.type: unknown resource type "cloudflare-kb"`,
+		},
+		{
+			name:   "output isn't an object",
+			upJson: `{"CORE_BASE_KV": {"config": {"type": "cloudflare-kv", "name": "CORE_BASE_KV"}, "dependencies": [], "output": []}}`,
+			err:    "CORE_BASE_KV.output: expected object, got array",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+			r.upJsonPath = filepath.Join(t.TempDir(), "gas.up.json")
+			err := os.WriteFile(r.upJsonPath, []byte(tt.upJson), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = r.setUpJson()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = r.setUpNameToConfig()
+			if err == nil {
+				err = r.setUpNameToOutput()
+			}
+
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.err)
+			}
+			if !strings.Contains(err.Error(), r.upJsonPath) || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %q, expected it to contain %q and %q", err, r.upJsonPath, tt.err)
+			}
+		})
+	}
+}
+
+/*
+Tokens are usually created before the first deploy, so
+required permissions are those of creating every resource
+when there's no up .json file.
+*/
+func TestRequiredPermissionsWithoutUpJson(t *testing.T) {
+	upJsonPath := filepath.Join(t.TempDir(), "gas.up.json")
+
+	r := New()
+	r.upJsonPath = upJsonPath
+	err := r.setUpJson()
+	if err == nil {
+		t.Fatal("got no error, expected a missing up .json file to fail to read")
+	}
+
+	r = New()
+	r.upJsonPath = upJsonPath
+	r.isUpJsonOptional = true
+	planTestResources(t, r, testKvExports)
+
+	for name, state := range r.nameToState {
+		if state != stateType(CREATED) {
+			t.Errorf("%s is %s, expected CREATED", name, state)
+		}
+	}
+
+	result := r.RequiredPermissions()
+	expected := map[string][]string{"": {"Workers KV Storage Write"}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, expected %v", result, expected)
+	}
+}
+
+func TestAccountToPermissions(t *testing.T) {
+	kv := config{"type": "cloudflare-kv", "name": "CORE_BASE_KV"}
+	worker := config{"type": "cloudflare-worker", "name": "CORE_BASE_API"}
+	workerWithRoutes := config{"type": "cloudflare-worker", "name": "CORE_BASE_API", "routes": []interface{}{map[string]interface{}{"pattern": "example.com/*", "zone": "CORE_BASE_ZONE"}}}
+	d1 := config{"type": "cloudflare-d1", "name": "CORE_BASE_DB"}
+	d1InOtherAccount := config{"type": "cloudflare-d1", "name": "CORE_BASE_DB", "account": "other"}
+
+	tests := []struct {
+		name     string
+		config   config
+		upConfig config
+		state    stateType
+		expected map[string][]string
+	}{
+		{
+			name:     "created",
+			config:   kv,
+			state:    stateType(CREATED),
+			expected: map[string][]string{"": {"Workers KV Storage Write"}},
+		},
+		{
+			name:     "deleted with up config's routes",
+			upConfig: workerWithRoutes,
+			state:    stateType(DELETED),
+			expected: map[string][]string{"": {"Workers Routes Write", "Workers Scripts Write"}},
+		},
+		{
+			name:     "updated to remove routes",
+			config:   worker,
+			upConfig: workerWithRoutes,
+			state:    stateType(UPDATED),
+			expected: map[string][]string{"": {"Workers Routes Write", "Workers Scripts Write"}},
+		},
+		{
+			name:     "replaced in another account",
+			config:   d1InOtherAccount,
+			upConfig: d1,
+			state:    stateType(UPDATED),
+			expected: map[string][]string{"": {"D1 Write"}, "other": {"D1 Write"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+			r.nameToConfig = make(nameToConfig)
+			r.upNameToConfig = make(upNameToConfig)
+			if tt.config != nil {
+				r.nameToConfig["CORE_BASE_RESOURCE"] = configs[tt.config["type"].(string)](tt.config)
+			}
+			if tt.upConfig != nil {
+				r.upNameToConfig["CORE_BASE_RESOURCE"] = configs[tt.upConfig["type"].(string)](tt.upConfig)
+			}
+			r.nameToState = nameToState{"CORE_BASE_RESOURCE": tt.state}
+			r.setNameToConfigChanges()
+
+			result := r.accountToPermissions(map[string]stateType{"CORE_BASE_RESOURCE": tt.state})
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("got %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+/*
+Deps are the configs a config refers to through its types'
+reference fields, plus the configs of resource packages its
+package.json declares. A declared package that no config
+refers to is a warning.
+*/
+func TestSetNameToDeps(t *testing.T) {
+	binding := func(name string) []interface{} {
+		return []interface{}{map[string]interface{}{"binding": name}}
+	}
+	export := func(exportName string, c config) []*exportedConfig {
+		return []*exportedConfig{{ExportName: exportName, Config: c}}
+	}
+
+	kv := export("coreBaseKv", config{"type": "cloudflare-kv", "name": "CORE_BASE_KV"})
+	db := export("coreBaseDb", config{"type": "cloudflare-d1", "name": "CORE_BASE_DB"})
+	api := export("coreBaseApi", config{"type": "cloudflare-worker", "name": "CORE_BASE_API", "kv": binding("CORE_BASE_KV")})
+
+	tests := []struct {
+		name                    string
+		subdirPathToExports     map[string][]*exportedConfig
+		subdirPathToPackageJson map[string]*packageJson
+		expected                nameToDeps
+		expectedWarning         string
+	}{
+		{
+			name: "referenced config",
+			subdirPathToExports: map[string][]*exportedConfig{
+				"gas/core-base-kv":  kv,
+				"gas/core-base-api": api,
+			},
+			expected: nameToDeps{
+				"CORE_BASE_KV":  {},
+				"CORE_BASE_API": {"CORE_BASE_KV"},
+			},
+		},
+		{
+			name: "worker bindings, queues, routes and Durable Objects",
+			subdirPathToExports: map[string][]*exportedConfig{
+				"gas/core-base-kv":         kv,
+				"gas/core-base-db":         db,
+				"gas/core-base-bucket":     export("coreBaseBucket", config{"type": "cloudflare-r2", "name": "CORE_BASE_BUCKET"}),
+				"gas/core-base-hyperdrive": export("coreBaseHyperdrive", config{"type": "cloudflare-hyperdrive", "name": "CORE_BASE_HYPERDRIVE", "connectionStringSecret": "DATABASE_URL"}),
+				"gas/core-base-index":      export("coreBaseIndex", config{"type": "cloudflare-vectorize", "name": "CORE_BASE_INDEX", "dimensions": float64(768), "metric": "cosine"}),
+				"gas/core-base-jobs":       export("coreBaseJobs", config{"type": "cloudflare-queue", "name": "CORE_BASE_JOBS"}),
+				"gas/core-base-events":     export("coreBaseEvents", config{"type": "cloudflare-queue", "name": "CORE_BASE_EVENTS"}),
+				"gas/core-base-zone":       export("coreBaseZone", config{"type": "cloudflare-dns-zone", "name": "CORE_BASE_ZONE", "domain": "example.com"}),
+				"gas/core-base-auth":       export("coreBaseAuth", config{"type": "cloudflare-worker", "name": "CORE_BASE_AUTH"}),
+				"gas/core-base-chat":       export("coreBaseChat", config{"type": "cloudflare-worker", "name": "CORE_BASE_CHAT"}),
+				"gas/core-base-api": export("coreBaseApi", config{
+					"type":       "cloudflare-worker",
+					"name":       "CORE_BASE_API",
+					"kv":         binding("CORE_BASE_KV"),
+					"d1":         binding("CORE_BASE_DB"),
+					"r2":         binding("CORE_BASE_BUCKET"),
+					"hyperdrive": binding("CORE_BASE_HYPERDRIVE"),
+					"vectorize":  binding("CORE_BASE_INDEX"),
+					"services":   binding("CORE_BASE_AUTH"),
+					"queues": map[string]interface{}{
+						"producers": binding("CORE_BASE_JOBS"),
+						"consumers": []interface{}{map[string]interface{}{"queue": "CORE_BASE_EVENTS"}},
+					},
+					"routes": []interface{}{map[string]interface{}{"pattern": "example.com/*", "zone": "CORE_BASE_ZONE"}},
+					"durableObjects": map[string]interface{}{
+						"bindings": []interface{}{map[string]interface{}{"binding": "ROOMS", "className": "Room", "worker": "CORE_BASE_CHAT"}},
+					},
+				}),
+			},
+			expected: nameToDeps{
+				"CORE_BASE_KV":         {},
+				"CORE_BASE_DB":         {},
+				"CORE_BASE_BUCKET":     {},
+				"CORE_BASE_HYPERDRIVE": {},
+				"CORE_BASE_INDEX":      {},
+				"CORE_BASE_JOBS":       {},
+				"CORE_BASE_EVENTS":     {},
+				"CORE_BASE_ZONE":       {},
+				"CORE_BASE_AUTH":       {},
+				"CORE_BASE_CHAT":       {},
+				"CORE_BASE_API":        {"CORE_BASE_AUTH", "CORE_BASE_BUCKET", "CORE_BASE_CHAT", "CORE_BASE_DB", "CORE_BASE_EVENTS", "CORE_BASE_HYPERDRIVE", "CORE_BASE_INDEX", "CORE_BASE_JOBS", "CORE_BASE_KV", "CORE_BASE_ZONE"},
+			},
+		},
+		{
+			name: "declared packages of every dependency kind",
+			subdirPathToExports: map[string][]*exportedConfig{
+				"gas/core-base-kv":     kv,
+				"gas/core-base-db":     db,
+				"gas/core-base-bucket": export("coreBaseBucket", config{"type": "cloudflare-r2", "name": "CORE_BASE_BUCKET"}),
+				"gas/core-base-api":    api,
+			},
+			subdirPathToPackageJson: map[string]*packageJson{
+				"gas/core-base-api": {
+					DevDependencies:  map[string]string{"core-base-db": "workspace:*"},
+					PeerDependencies: map[string]string{"core-base-bucket": "workspace:*"},
+				},
+			},
+			expected: nameToDeps{
+				"CORE_BASE_KV":     {},
+				"CORE_BASE_DB":     {},
+				"CORE_BASE_BUCKET": {},
+				"CORE_BASE_API":    {"CORE_BASE_BUCKET", "CORE_BASE_DB", "CORE_BASE_KV"},
+			},
+			expectedWarning: "Warning: gas/core-base-api/package.json depends on core-base-bucket, but none of its configs refer to CORE_BASE_BUCKET\n" +
+				"Warning: gas/core-base-api/package.json depends on core-base-db, but none of its configs refer to CORE_BASE_DB\n",
+		},
+		{
+			name: "declared package that's also referenced",
+			subdirPathToExports: map[string][]*exportedConfig{
+				"gas/core-base-kv":  kv,
+				"gas/core-base-api": api,
+			},
+			subdirPathToPackageJson: map[string]*packageJson{
+				"gas/core-base-api": {Dependencies: map[string]string{"core-base-kv": "workspace:*"}},
+			},
+			expected: nameToDeps{
+				"CORE_BASE_KV":  {},
+				"CORE_BASE_API": {"CORE_BASE_KV"},
+			},
+		},
+		{
+			name: "configs in the same package",
+			subdirPathToExports: map[string][]*exportedConfig{
+				"gas/core-base": {kv[0], api[0]},
+			},
+			expected: nameToDeps{
+				"CORE_BASE_KV":  {},
+				"CORE_BASE_API": {"CORE_BASE_KV"},
+			},
+		},
+		{
+			name: "strings naming a config outside reference fields",
+			subdirPathToExports: map[string][]*exportedConfig{
+				"gas/core-base-kv":   kv,
+				"gas/core-base-zone": export("coreBaseZone", config{"type": "cloudflare-dns-zone", "name": "CORE_BASE_ZONE", "domain": "example.com"}),
+				"gas/core-base-web": export("coreBaseWeb", config{
+					"type": "cloudflare-worker",
+					"name": "CORE_BASE_WEB",
+					"vars": map[string]interface{}{"CACHE": "CORE_BASE_KV"},
+				}),
+				"gas/core-base-record": export("coreBaseRecord", config{"type": "cloudflare-dns-record", "name": "CORE_BASE_RECORD", "zone": "CORE_BASE_ZONE", "recordType": "TXT", "recordName": "verify", "content": "CORE_BASE_WEB"}),
+			},
+			expected: nameToDeps{
+				"CORE_BASE_KV":     {},
+				"CORE_BASE_ZONE":   {},
+				"CORE_BASE_WEB":    {},
+				"CORE_BASE_RECORD": {"CORE_BASE_ZONE"},
+			},
+		},
+		{
+			name: "ref to a missing config",
+			subdirPathToExports: map[string][]*exportedConfig{
+				"gas/core-base-api": api,
+			},
+			expected: nameToDeps{
+				"CORE_BASE_API": {},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+			r.containerSubdirPathToPackageJson = make(containerSubdirPathToPackageJson)
+			r.containerSubdirPathToIndexFilePath = make(containerSubdirPathToIndexFilePath)
+			r.runNodeJsConfigScriptResult = make(runNodeJsConfigScriptResult)
+			for subdirPath, exports := range tt.subdirPathToExports {
+				packageJson := &packageJson{}
+				if declared, ok := tt.subdirPathToPackageJson[subdirPath]; ok {
+					packageJson = declared
+				}
+				packageJson.Name = filepath.Base(subdirPath)
+				r.containerSubdirPathToPackageJson[subdirPath] = packageJson
+				r.containerSubdirPathToIndexFilePath[subdirPath] = filepath.Join(subdirPath, "src", "index.ts")
+				r.runNodeJsConfigScriptResult[subdirPath] = exports
+			}
+			r.setPackageJsonNameToContainerSubdirPath()
+
+			problems := r.setNameToConfig()
+			if len(problems) > 0 {
+				t.Fatal(strings.Join(problems, "\n"))
+			}
+			warning := captureStdout(t, r.setNameToDeps)
+
+			if !reflect.DeepEqual(r.nameToDeps, tt.expected) {
+				t.Errorf("got %v, expected %v", r.nameToDeps, tt.expected)
+			}
+			if warning != tt.expectedWarning {
+				t.Errorf("got warning %q, expected %q", warning, tt.expectedWarning)
+			}
+		})
+	}
+}
+
+func TestShouldReplace(t *testing.T) {
+	tests := []struct {
+		name     string
+		upConfig config
+		config   config
+		expected bool
+	}{
+		{
+			name:     "renamed KV namespace",
+			upConfig: config{"type": "cloudflare-kv", "name": "CORE_BASE_KV"},
+			config:   config{"type": "cloudflare-kv", "name": "CORE_BASE_CACHE"},
+			expected: false,
+		},
+		{
+			name:     "renamed D1 database",
+			upConfig: config{"type": "cloudflare-d1", "name": "CORE_BASE_DB"},
+			config:   config{"type": "cloudflare-d1", "name": "CORE_BASE_DATA"},
+			expected: true,
+		},
+		{
+			name:     "D1 database with a new location hint",
+			upConfig: config{"type": "cloudflare-d1", "name": "CORE_BASE_DB"},
+			config:   config{"type": "cloudflare-d1", "name": "CORE_BASE_DB", "locationHint": "weur"},
+			expected: true,
+		},
+		{
+			name:     "worker with new crons",
+			upConfig: config{"type": "cloudflare-worker", "name": "CORE_BASE_API"},
+			config:   config{"type": "cloudflare-worker", "name": "CORE_BASE_API", "crons": []interface{}{"0 * * * *"}},
+			expected: false,
+		},
+		{
+			name:     "worker moved to another account",
+			upConfig: config{"type": "cloudflare-worker", "name": "CORE_BASE_API"},
+			config:   config{"type": "cloudflare-worker", "name": "CORE_BASE_API", "account": "other"},
+			expected: true,
+		},
+		{
+			name:     "KV namespace changed to a D1 database",
+			upConfig: config{"type": "cloudflare-kv", "name": "CORE_BASE_RESOURCE"},
+			config:   config{"type": "cloudflare-d1", "name": "CORE_BASE_RESOURCE"},
+			expected: true,
+		},
+		{
+			name:     "D1 database changed to a Vectorize index",
+			upConfig: config{"type": "cloudflare-d1", "name": "CORE_BASE_RESOURCE"},
+			config:   config{"type": "cloudflare-vectorize", "name": "CORE_BASE_RESOURCE", "dimensions": float64(768), "metric": "cosine"},
+			expected: true,
+		},
+		{
+			name:     "DNS zone with a new domain",
+			upConfig: config{"type": "cloudflare-dns-zone", "name": "CORE_BASE_ZONE", "domain": "example.com"},
+			config:   config{"type": "cloudflare-dns-zone", "name": "CORE_BASE_ZONE", "domain": "example.org"},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+			r.upNameToConfig = upNameToConfig{"CORE_BASE_RESOURCE": configs[tt.upConfig["type"].(string)](tt.upConfig)}
+			r.nameToConfig = nameToConfig{"CORE_BASE_RESOURCE": configs[tt.config["type"].(string)](tt.config)}
+			r.nameToState = nameToState{"CORE_BASE_RESOURCE": stateType(UPDATED)}
+			r.setNameToConfigChanges()
+
+			result := r.shouldReplace("CORE_BASE_RESOURCE")
+			if result != tt.expected {
+				t.Errorf("got %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+/*
+A changed config that can be updated in place is deployed
+with its type's UPDATED processor, without creating or
+deleting anything.
+*/
+func TestConfigChangeUpdatesInPlace(t *testing.T) {
+	upJsonPath := newTestUpJsonPath(t, "{}")
+
+	deployTestResources(t, newTestResources(t, upJsonPath, testDnsExports), testDnsOutputs)
+
+	processed := make([]processorKeyType, 0)
+	for _, key := range []processorKeyType{CLOUDFLARE_DNS_ZONE_CREATED, CLOUDFLARE_DNS_ZONE_DELETED, CLOUDFLARE_DNS_RECORD_CREATED, CLOUDFLARE_DNS_RECORD_DELETED, CLOUDFLARE_DNS_RECORD_UPDATED} {
+		key := key
+		setTestProcessor(t, key, func(p *processorParams) {
+			processed = append(processed, key)
+			p.processOkChan <- true
+		})
+	}
+
+	r := newTestResources(t, upJsonPath, map[string][]*exportedConfig{
+		"gas/core-base-zone": testDnsExports["gas/core-base-zone"],
+		"gas/core-base-record": {
+			{ExportName: "coreBaseRecord", Config: config{"type": "cloudflare-dns-record", "name": "CORE_BASE_RECORD", "zone": "CORE_BASE_ZONE", "recordType": "A", "recordName": "www", "content": "192.0.2.2"}},
+		},
+	})
+	groupTestResources(t, r)
+
+	err := r.Deploy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []processorKeyType{CLOUDFLARE_DNS_RECORD_UPDATED}
+	if !reflect.DeepEqual(processed, expected) {
+		t.Errorf("got processors %v, expected %v", processed, expected)
+	}
+}
+
+/*
+A failed resource cancels the PENDING resources of its own
+group. Other groups are independent, so they finish
+deploying.
+*/
+func TestFailedGroupDoesNotCancelOtherGroups(t *testing.T) {
+	setTestProcessor(t, CLOUDFLARE_DNS_ZONE_CREATED, func(p *processorParams) {
+		if p.name == "SHOP_ZONE" {
+			p.processOkChan <- false
+			return
+		}
+		// Keeps BLOG_RECORD PENDING while SHOP_ZONE fails.
+		time.Sleep(50 * time.Millisecond)
+		p.deployOutput.mu.Lock()
+		p.deployOutput.m[p.name] = &CloudflareDnsZoneOutput{ID: "zone-id", Domain: "blog.example.com", NameServers: []string{}}
+		p.deployOutput.mu.Unlock()
+		p.processOkChan <- true
+	})
+	setTestProcessor(t, CLOUDFLARE_DNS_RECORD_CREATED, func(p *processorParams) {
+		p.deployOutput.mu.Lock()
+		p.deployOutput.m[p.name] = &CloudflareDnsRecordOutput{ID: "record-id", ZoneID: "zone-id"}
+		p.deployOutput.mu.Unlock()
+		p.processOkChan <- true
+	})
+
+	r := newTestResources(t, newTestUpJsonPath(t, "{}"), map[string][]*exportedConfig{
+		"gas/shop": {
+			{ExportName: "shopZone", Config: config{"type": "cloudflare-dns-zone", "name": "SHOP_ZONE", "domain": "shop.example.com"}},
+			{ExportName: "shopRecord", Config: config{"type": "cloudflare-dns-record", "name": "SHOP_RECORD", "zone": "SHOP_ZONE", "recordType": "A", "recordName": "www", "content": "192.0.2.1"}},
+		},
+		"gas/blog": {
+			{ExportName: "blogZone", Config: config{"type": "cloudflare-dns-zone", "name": "BLOG_ZONE", "domain": "blog.example.com"}},
+			{ExportName: "blogRecord", Config: config{"type": "cloudflare-dns-record", "name": "BLOG_RECORD", "zone": "BLOG_ZONE", "recordType": "A", "recordName": "www", "content": "192.0.2.2"}},
+		},
+	})
+	groupTestResources(t, r)
+	if len(r.groupsWithStateChanges) != 2 {
+		t.Fatalf("got groups %v, expected 2", r.groupToNames)
+	}
+
+	errChan := make(chan error)
+	go func() {
+		errChan <- r.Deploy()
+	}()
+
+	select {
+	case err := <-errChan:
+		if err == nil {
+			t.Error("expected the deploy to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("deploy didn't finish")
+	}
+
+	expected := map[string]deployState{
+		"SHOP_ZONE":   deployState(CREATE_FAILED),
+		"SHOP_RECORD": deployState(CANCELED),
+		"BLOG_ZONE":   deployState(CREATE_COMPLETE),
+		"BLOG_RECORD": deployState(CREATE_COMPLETE),
+	}
+	if !reflect.DeepEqual(r.nameToDeployStateContainer.m, expected) {
+		t.Errorf("got deploy states %v, expected %v", r.nameToDeployStateContainer.m, expected)
+	}
+}
+
+/*
+A resource whose type changed is created as its new type and
+deleted as the type it was deployed as.
+*/
+func TestReplaceDeletesAsUpType(t *testing.T) {
+	processed := make([]processorKeyType, 0)
+	for _, key := range []processorKeyType{CLOUDFLARE_D1_CREATED, CLOUDFLARE_D1_DELETED, CLOUDFLARE_KV_CREATED, CLOUDFLARE_KV_DELETED} {
+		key := key
+		setTestProcessor(t, key, func(p *processorParams) {
+			processed = append(processed, key)
+			p.processOkChan <- true
+		})
+	}
+
+	r := New()
+	r.upNameToConfig = upNameToConfig{"CORE_BASE_RESOURCE": configs["cloudflare-kv"](config{"type": "cloudflare-kv", "name": "CORE_BASE_RESOURCE"})}
+	r.upNameToOutput = upNameToOutput{"CORE_BASE_RESOURCE": &CloudflareKVOutput{ID: "kv-id"}}
+	r.nameToConfig = nameToConfig{"CORE_BASE_RESOURCE": configs["cloudflare-d1"](config{"type": "cloudflare-d1", "name": "CORE_BASE_RESOURCE"})}
+	r.nameToState = nameToState{"CORE_BASE_RESOURCE": stateType(UPDATED)}
+	r.nameToDeployOutputContainer = &nameToDeployOutputContainer{m: make(map[string]interface{})}
+	r.setNameToConfigChanges()
+
+	params := r.newProcessorParams("CORE_BASE_RESOURCE", make(processorOkChanType))
+	go r.replaceName(params, r.nameToType("CORE_BASE_RESOURCE"))
+	if !<-params.processOkChan {
+		t.Fatal("expected the replace to succeed")
+	}
+
+	expected := []processorKeyType{CLOUDFLARE_D1_CREATED, CLOUDFLARE_KV_DELETED}
+	if !reflect.DeepEqual(processed, expected) {
+		t.Errorf("got processors %v, expected %v", processed, expected)
+	}
+}
+
+/*
+A replaced resource that can't be deleted is kept in the up
+.json file under another name so it's deleted on the next
+deploy. The new resource is saved, so it isn't replaced
+again.
+*/
+func TestReplaceThatCantDeleteKeepsReplacedResource(t *testing.T) {
+	upJsonPath := newTestUpJsonPath(t, "{}")
+
+	deployTestResources(t, newTestResources(t, upJsonPath, testDnsExports), testDnsOutputs)
+
+	exports := map[string][]*exportedConfig{
+		"gas/core-base-zone": {
+			{ExportName: "coreBaseZone", Config: config{"type": "cloudflare-dns-zone", "name": "CORE_BASE_ZONE", "domain": "example.org"}},
+		},
+		"gas/core-base-record": testDnsExports["gas/core-base-record"],
+	}
+
+	setTestProcessor(t, CLOUDFLARE_DNS_ZONE_CREATED, func(p *processorParams) {
+		p.deployOutput.mu.Lock()
+		p.deployOutput.m[p.name] = &CloudflareDnsZoneOutput{ID: "new-zone-id", Domain: "example.org", NameServers: []string{}}
+		p.deployOutput.mu.Unlock()
+		p.processOkChan <- true
+	})
+	setTestProcessor(t, CLOUDFLARE_DNS_ZONE_DELETED, func(p *processorParams) {
+		p.processOkChan <- false
+	})
+	setTestProcessor(t, CLOUDFLARE_DNS_RECORD_UPDATED, func(p *processorParams) {
+		p.deployOutput.mu.Lock()
+		p.deployOutput.m[p.name] = &CloudflareDnsRecordOutput{ID: "new-record-id", ZoneID: "new-zone-id"}
+		p.deployOutput.mu.Unlock()
+		p.processOkChan <- true
+	})
+
+	r := newTestResources(t, upJsonPath, exports)
+	groupTestResources(t, r)
+	err := r.Deploy()
+	if err == nil || !strings.Contains(err.Error(), "CORE_BASE_ZONE") {
+		t.Fatalf("got error %v, expected it to name CORE_BASE_ZONE", err)
+	}
+	if state := r.nameToDeployStateContainer.m["CORE_BASE_RECORD"]; state != deployState(UPDATE_COMPLETE) {
+		t.Errorf("CORE_BASE_RECORD is %s, expected it to move to the new zone", state)
+	}
+
+	next := newTestResources(t, upJsonPath, exports)
+
+	expected := nameToState{
+		"CORE_BASE_ZONE":          stateType(UNCHANGED),
+		"CORE_BASE_RECORD":        stateType(UNCHANGED),
+		"CORE_BASE_ZONE:replaced": stateType(DELETED),
+	}
+	if !reflect.DeepEqual(next.nameToState, expected) {
+		t.Errorf("got states %v, expected %v", next.nameToState, expected)
+	}
+	if output := next.upNameToOutput["CORE_BASE_ZONE"].(*CloudflareDnsZoneOutput); output.ID != "new-zone-id" {
+		t.Errorf("got CORE_BASE_ZONE output %v, expected the new zone's", output)
+	}
+	if output := next.upNameToOutput["CORE_BASE_ZONE:replaced"].(*CloudflareDnsZoneOutput); output.ID != "zone-id" {
+		t.Errorf("got CORE_BASE_ZONE:replaced output %v, expected the replaced zone's", output)
+	}
+}
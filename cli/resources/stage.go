@@ -0,0 +1,46 @@
+package resources
+
+import (
+	"github.com/spf13/viper"
+)
+
+/*
+Stage config is the part of gas.config.json that differs per
+stage (see --stage). Values are keyed by resource name:
+
+	{
+	  "project": "example",
+	  "stages": {
+	    "prod": {
+	      "vars": {
+	        "CORE_BASE_API": { "LOG_LEVEL": "warn" }
+	      }
+	    }
+	  }
+	}
+*/
+type stageConfig struct {
+	Vars map[string]map[string]string `json:"vars,omitempty"`
+}
+
+func readStageConfig() (*stageConfig, error) {
+	result := &stageConfig{
+		Vars: make(map[string]map[string]string),
+	}
+
+	config, err := readGasConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	stage, ok := config.Stages[viper.GetString("stage")]
+	if !ok || stage == nil {
+		return result, nil
+	}
+
+	if stage.Vars != nil {
+		result.Vars = stage.Vars
+	}
+
+	return result, nil
+}
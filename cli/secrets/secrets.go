@@ -0,0 +1,311 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gas/helpers"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+/*
+Secrets are stored per stage and resource in the secrets
+.json file (gas.secrets.json by default):
+
+	{
+	  "dev": {
+	    "CORE_BASE_API": {
+	      "API_KEY": { "value": "<encrypted>" },
+	      "STRIPE_KEY": { "env": "STRIPE_KEY" }
+	    }
+	  }
+	}
+
+A secret either has an encrypted value or the name of an env
+var to read its value from when deploying (e.g. in CI).
+
+Values are encrypted with a key read from the GAS_SECRETS_KEY
+env var or, if it isn't set, from a key file in the user's
+config dir that's created on first use (but not in CI, where
+GAS_SECRETS_KEY has to be set). The key never goes in the
+project, so the secrets .json file can be committed.
+*/
+type Store struct {
+	path   string
+	stages map[string]map[string]map[string]*entry
+	key    []byte
+}
+
+type entry struct {
+	Value string `json:"value,omitempty"`
+	Env   string `json:"env,omitempty"`
+}
+
+type Secret struct {
+	Key string
+	Env string
+}
+
+func Load() (*Store, error) {
+	s := &Store{
+		path:   viper.GetString("secretsJsonPath"),
+		stages: make(map[string]map[string]map[string]*entry),
+	}
+
+	if !helpers.IsFilePresent(s.path) {
+		return s, nil
+	}
+
+	err := helpers.UnmarshallFile(s.path, &s.stages)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(s.stages, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(s.path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to write secrets file %s\n%v", s.path, err)
+	}
+
+	return nil
+}
+
+func (s *Store) entries(stage string, resource string) map[string]*entry {
+	if _, ok := s.stages[stage]; !ok {
+		s.stages[stage] = make(map[string]map[string]*entry)
+	}
+	if _, ok := s.stages[stage][resource]; !ok {
+		s.stages[stage][resource] = make(map[string]*entry)
+	}
+	return s.stages[stage][resource]
+}
+
+func (s *Store) Set(stage string, resource string, key string, value string) error {
+	encryptedValue, err := s.encrypt(value)
+	if err != nil {
+		return err
+	}
+	s.entries(stage, resource)[key] = &entry{Value: encryptedValue}
+	return nil
+}
+
+func (s *Store) SetFromEnv(stage string, resource string, key string, env string) {
+	s.entries(stage, resource)[key] = &entry{Env: env}
+}
+
+func (s *Store) Remove(stage string, resource string, key string) error {
+	entries := s.entries(stage, resource)
+	if _, ok := entries[key]; !ok {
+		return fmt.Errorf("secret %s of %s doesn't exist in stage %s", key, resource, stage)
+	}
+
+	delete(entries, key)
+
+	if len(entries) == 0 {
+		delete(s.stages[stage], resource)
+	}
+	if len(s.stages[stage]) == 0 {
+		delete(s.stages, stage)
+	}
+
+	return nil
+}
+
+/*
+List returns a resource's secrets sorted by key, without
+their values.
+*/
+func (s *Store) List(stage string, resource string) []Secret {
+	result := make([]Secret, 0)
+	for key, entry := range s.stages[stage][resource] {
+		result = append(result, Secret{Key: key, Env: entry.Env})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+/*
+Values returns a resource's decrypted secret values by key.
+Secrets read from env vars have to be set.
+*/
+func (s *Store) Values(stage string, resource string) (map[string]string, error) {
+	result := make(map[string]string)
+	for key, entry := range s.stages[stage][resource] {
+		if entry.Env != "" {
+			value, ok := os.LookupEnv(entry.Env)
+			if !ok {
+				return nil, fmt.Errorf("env var %s of secret %s of %s is not set", entry.Env, key, resource)
+			}
+			result[key] = value
+			continue
+		}
+
+		value, err := s.decrypt(entry.Value)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt secret %s of %s\n%v", key, resource, err)
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+/*
+Hashes are what's stored in the up .json file to detect
+changed secrets. They're keyed with the encryption key so
+they can't be used to guess values.
+*/
+func (s *Store) Hash(value string) (string, error) {
+	key, err := s.loadKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (s *Store) Hashes(values map[string]string) (map[string]string, error) {
+	result := make(map[string]string)
+	for key, value := range values {
+		hash, err := s.Hash(value)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = hash
+	}
+	return result, nil
+}
+
+func keyFilePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "gas", "keys", helpers.StringToLowerCaseKebab(viper.GetString("project"))+".key"), nil
+}
+
+func (s *Store) loadKey() ([]byte, error) {
+	if s.key != nil {
+		return s.key, nil
+	}
+
+	encodedKey := os.Getenv("GAS_SECRETS_KEY")
+
+	if encodedKey == "" {
+		path, err := keyFilePath()
+		if err != nil {
+			return nil, fmt.Errorf("unable to find secrets key file\n%v", err)
+		}
+
+		if !helpers.IsFilePresent(path) {
+			// A key generated in CI would be thrown away with the
+			// runner and couldn't decrypt the committed secrets.
+			if os.Getenv("CI") != "" {
+				return nil, fmt.Errorf("GAS_SECRETS_KEY is not set, set it to the project's secrets key in CI")
+			}
+
+			key := make([]byte, 32)
+			_, err = rand.Read(key)
+			if err != nil {
+				return nil, err
+			}
+
+			err = os.MkdirAll(filepath.Dir(path), 0700)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create secrets key dir\n%v", err)
+			}
+
+			err = os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)), 0600)
+			if err != nil {
+				return nil, fmt.Errorf("unable to write secrets key file %s\n%v", path, err)
+			}
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read secrets key file %s\n%v", path, err)
+		}
+		encodedKey = strings.TrimSpace(string(data))
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("secrets key must be 32 base64 encoded bytes")
+	}
+
+	s.key = key
+
+	return s.key, nil
+}
+
+func (s *Store) newGCM() (cipher.AEAD, error) {
+	key, err := s.loadKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *Store) encrypt(value string) (string, error) {
+	gcm, err := s.newGCM()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(value), nil)), nil
+}
+
+func (s *Store) decrypt(encryptedValue string) (string, error) {
+	gcm, err := s.newGCM()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encryptedValue)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("encrypted value is too short")
+	}
+
+	value, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(value), nil
+}
@@ -0,0 +1,142 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"gas/helpers"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		secretsKey string
+		ci         string
+		err        string
+		keyFile    bool
+	}{
+		{
+			name:       "key from env var",
+			secretsKey: base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))),
+		},
+		{
+			name:    "key file created on first use",
+			keyFile: true,
+		},
+		{
+			name: "no key in CI",
+			ci:   "true",
+			err:  "GAS_SECRETS_KEY is not set",
+		},
+		{
+			name:       "key of the wrong length",
+			secretsKey: base64.StdEncoding.EncodeToString([]byte("short")),
+			err:        "secrets key must be 32 base64 encoded bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configDir := t.TempDir()
+			t.Setenv("XDG_CONFIG_HOME", configDir)
+			t.Setenv("HOME", configDir)
+			t.Setenv("GAS_SECRETS_KEY", tt.secretsKey)
+			t.Setenv("CI", tt.ci)
+
+			s := &Store{}
+			_, err := s.loadKey()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, expected it to contain %q", err, tt.err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			path, err := keyFilePath()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(path); (err == nil) != tt.keyFile {
+				t.Errorf("got key file %v, expected %v", err == nil, tt.keyFile)
+			}
+			if !strings.HasPrefix(path, filepath.Clean(configDir)) {
+				t.Errorf("key file %s is outside the test config dir", path)
+			}
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	newStore := func(key string) *Store {
+		return &Store{key: []byte(strings.Repeat(key, 32))}
+	}
+
+	hash, err := newStore("a").Hash("value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sameHash, err := newStore("a").Hash("value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != sameHash {
+		t.Errorf("got different hashes %s and %s of the same value and key", hash, sameHash)
+	}
+
+	otherKeyHash, err := newStore("b").Hash("value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == otherKeyHash {
+		t.Errorf("got the same hash %s with different keys", hash)
+	}
+}
+
+/*
+Values are saved encrypted and read back decrypted, so the
+secrets .json file never has them in plain text.
+*/
+func TestStoreSavesEncryptedValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gas.secrets.json")
+	key := []byte(strings.Repeat("k", 32))
+
+	s := &Store{path: path, stages: make(map[string]map[string]map[string]*entry), key: key}
+	err := s.Set("dev", "CORE_BASE_API", "API_KEY", "sk_live_value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetFromEnv("dev", "CORE_BASE_API", "STRIPE_KEY", "TEST_STRIPE_KEY")
+	err = s.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk_live_value") {
+		t.Errorf("secrets file %s has a value in plain text", data)
+	}
+
+	t.Setenv("TEST_STRIPE_KEY", "sk_test_value")
+
+	loaded := &Store{path: path, key: key}
+	err = helpers.UnmarshallFile(path, &loaded.stages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := loaded.Values("dev", "CORE_BASE_API")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"API_KEY": "sk_live_value", "STRIPE_KEY": "sk_test_value"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("got %v, expected %v", values, expected)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"gas/degit"
 	"gas/helpers"
+	"gas/resources"
 	uicommon "gas/ui/ui-common"
 	"os"
 	"os/exec"
@@ -505,6 +506,11 @@ func downloadNewProjectTemplate(dirPath string, packageManager string) tea.Cmd {
 			return downloadNewProjectTemplateErr(errMsg)
 		}
 
+		_, err = resources.WriteSchemas(filepath.Join(extractPath, resources.DefaultSchemasDir))
+		if err != nil {
+			return downloadNewProjectTemplateErr(err)
+		}
+
 		packageJsonPath := filepath.Join(extractPath, "package.json")
 
 		packageJsonFile, err := os.ReadFile(packageJsonPath)
@@ -1,29 +1,163 @@
-import { Fetcher, KVNamespace } from "@cloudflare/workers-types";
+import {
+	AnalyticsEngineDataset,
+	D1Database,
+	DurableObjectNamespace,
+	Fetcher,
+	Hyperdrive,
+	KVNamespace,
+	Queue,
+	R2Bucket,
+	Vectorize,
+} from "@cloudflare/workers-types";
 
-export type Resources = CloudflareKv | CloudflarePages | CloudflareWorker;
+export type Resources =
+	| CloudflareD1
+	| CloudflareDnsRecord
+	| CloudflareDnsZone
+	| CloudflareHyperdrive
+	| CloudflareKv
+	| CloudflarePages
+	| CloudflareQueue
+	| CloudflareR2
+	| CloudflareVectorize
+	| CloudflareWorker;
+
+export type AnalyticsEngineDatasetBindings<
+	T extends ReadonlyArray<{ readonly binding: string }>,
+> = {
+	[P in T[number]["binding"]]: AnalyticsEngineDataset;
+};
+
+export type D1Bindings<T extends ReadonlyArray<{ readonly binding: string }>> =
+	{
+		[P in T[number]["binding"]]: D1Database;
+	};
+
+export type DurableObjectBindings<
+	T extends ReadonlyArray<{ readonly binding: string }>,
+> = {
+	[P in T[number]["binding"]]: DurableObjectNamespace;
+};
+
+export type HyperdriveBindings<
+	T extends ReadonlyArray<{ readonly binding: string }>,
+> = {
+	[P in T[number]["binding"]]: Hyperdrive;
+};
 
 export type KvBindings<T extends ReadonlyArray<{ readonly binding: string }>> =
 	{
 		[P in T[number]["binding"]]: KVNamespace;
 	};
 
+export type QueueBindings<
+	T extends ReadonlyArray<{ readonly binding: string }>,
+> = {
+	[P in T[number]["binding"]]: Queue;
+};
+
+export type R2Bindings<T extends ReadonlyArray<{ readonly binding: string }>> =
+	{
+		[P in T[number]["binding"]]: R2Bucket;
+	};
+
 export type ServiceBindings<
 	T extends ReadonlyArray<{ readonly binding: string }>,
 > = {
 	[P in T[number]["binding"]]: Fetcher;
 };
 
+export type VectorizeBindings<
+	T extends ReadonlyArray<{ readonly binding: string }>,
+> = {
+	[P in T[number]["binding"]]: Vectorize;
+};
+
+export type CloudflareD1 = {
+	type: "cloudflare-d1";
+	id: string;
+	name: string;
+	account?: string;
+	locationHint?: "wnam" | "enam" | "weur" | "eeur" | "apac" | "oc";
+	migrationsDir?: string;
+};
+
+export function setCloudflareD1<T extends CloudflareD1>(resource: T): T {
+	return resource;
+}
+
+export type CloudflareDnsRecord = {
+	type: "cloudflare-dns-record";
+	id: string;
+	name: string;
+	account?: string;
+	zone: string;
+	recordType: "A" | "AAAA" | "CNAME" | "TXT" | "MX";
+	recordName: string;
+	content: string;
+	ttl?: number;
+	proxied?: boolean;
+	priority?: number;
+};
+
+export function setCloudflareDnsRecord<T extends CloudflareDnsRecord>(
+	resource: T,
+): T {
+	return resource;
+}
+
+export type CloudflareDnsZone = {
+	type: "cloudflare-dns-zone";
+	id: string;
+	name: string;
+	account?: string;
+	domain: string;
+	paused?: boolean;
+};
+
+export function setCloudflareDnsZone<T extends CloudflareDnsZone>(
+	resource: T,
+): T {
+	return resource;
+}
+
+export type CloudflareHyperdrive = {
+	type: "cloudflare-hyperdrive";
+	id: string;
+	name: string;
+	account?: string;
+	connectionStringSecret: string;
+	caching?: {
+		disabled?: boolean;
+		maxAge?: number;
+		staleWhileRevalidate?: number;
+	};
+};
+
+export function setCloudflareHyperdrive<T extends CloudflareHyperdrive>(
+	resource: T,
+): T {
+	return resource;
+}
+
 export type CloudflareKv = {
+	type: "cloudflare-kv";
+	id: string;
 	name: string;
+	account?: string;
 };
 
-export function cloudflareKv<T extends CloudflareKv>(resource: T): T {
+export function setCloudflareKv<T extends CloudflareKv>(resource: T): T {
 	return resource;
 }
 
 export type CloudflarePages = {
+	type: "cloudflare-pages";
 	id: string;
 	name: string;
+	account?: string;
+	outputDir?: string;
+	productionBranch?: string;
 	services?: Array<{
 		binding: string;
 	}>;
@@ -33,12 +167,135 @@ export function setCloudflarePages<T extends CloudflarePages>(resource: T): T {
 	return resource;
 }
 
+export type CloudflareQueue = {
+	type: "cloudflare-queue";
+	id: string;
+	name: string;
+	account?: string;
+};
+
+export function setCloudflareQueue<T extends CloudflareQueue>(resource: T): T {
+	return resource;
+}
+
+export type CloudflareR2 = {
+	type: "cloudflare-r2";
+	id: string;
+	name: string;
+	account?: string;
+	locationHint?: "wnam" | "enam" | "weur" | "eeur" | "apac" | "oc";
+	cors?: Array<{
+		allowedOrigins: Array<string>;
+		allowedMethods: Array<"GET" | "PUT" | "POST" | "DELETE" | "HEAD">;
+		allowedHeaders?: Array<string>;
+		exposeHeaders?: Array<string>;
+		maxAgeSeconds?: number;
+	}>;
+	lifecycle?: Array<{
+		id: string;
+		enabled?: boolean;
+		prefix?: string;
+		expireAfterDays?: number;
+		abortMultipartUploadsAfterDays?: number;
+	}>;
+};
+
+export function setCloudflareR2<T extends CloudflareR2>(resource: T): T {
+	return resource;
+}
+
+export type CloudflareVectorize = {
+	type: "cloudflare-vectorize";
+	id: string;
+	name: string;
+	account?: string;
+	dimensions: number;
+	metric: "cosine" | "euclidean" | "dot-product";
+	metadataIndexes?: Array<{
+		propertyName: string;
+		indexType: "string" | "number" | "boolean";
+	}>;
+};
+
+export function setCloudflareVectorize<T extends CloudflareVectorize>(
+	resource: T,
+): T {
+	return resource;
+}
+
 export type CloudflareWorker = {
+	type: "cloudflare-worker";
 	id: string;
 	name: string;
+	account?: string;
+	ai?: {
+		binding: string;
+	};
+	analyticsEngineDatasets?: Array<{
+		binding: string;
+		dataset?: string;
+	}>;
+	browser?: {
+		binding: string;
+	};
+	compatibilityDate?: string;
+	compatibilityFlags?: Array<string>;
+	crons?: Array<string>;
+	d1?: Array<{
+		binding: string;
+	}>;
+	domains?: Array<{
+		zone: string;
+		hostname: string;
+	}>;
+	durableObjects?: {
+		classes?: Array<{
+			className: string;
+			renamedFrom?: string;
+		}>;
+		bindings?: Array<{
+			binding: string;
+			className: string;
+			worker?: string;
+		}>;
+		allowDeletedClasses?: Array<string>;
+	};
+	hyperdrive?: Array<{
+		binding: string;
+	}>;
 	kv?: Array<{
 		binding: string;
 	}>;
+	queues?: {
+		producers?: Array<{
+			binding: string;
+		}>;
+		consumers?: Array<{
+			queue: string;
+			maxBatchSize?: number;
+			maxRetries?: number;
+			maxWaitTimeMs?: number;
+			deadLetterQueue?: string;
+		}>;
+	};
+	r2?: Array<{
+		binding: string;
+	}>;
+	routes?: Array<{
+		zone: string;
+		pattern: string;
+	}>;
+	services?: Array<{
+		binding: string;
+	}>;
+	vars?: Record<string, string>;
+	vectorize?: Array<{
+		binding: string;
+	}>;
+	versionMetadata?: {
+		binding: string;
+	};
+	workersDev?: boolean;
 };
 
 export function setCloudflareWorker<T extends CloudflareWorker>(
@@ -1,5 +1,8 @@
-export const config: {
-	name: string;
-} = {
+import { setCloudflareDnsZone } from "@gasoline-dev/resources";
+
+export const config = setCloudflareDnsZone({
+	type: "cloudflare-dns-zone",
+	id: "",
 	name: "",
-};
+	domain: "",
+} as const);
@@ -1,6 +1,7 @@
 import { setCloudflareKv } from "@gasoline-dev/resources";
 
 export const coreBaseKv = setCloudflareKv({
+	type: "cloudflare-kv",
 	id: "core:base:cloudflare-kv:v1:12345",
 	name: "",
 } as const);
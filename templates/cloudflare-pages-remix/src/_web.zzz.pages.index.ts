@@ -3,7 +3,9 @@ import { setCloudflarePages } from "@gasoline-dev/resources";
 import { coreBaseApi } from "gasoline-core-base-api";
 
 export const coreAppPages = setCloudflarePages({
+	type: "cloudflare-pages",
 	id: "",
+	outputDir: "build/client",
 	name: "",
 	services: [
 		{
@@ -2,6 +2,7 @@ import { Hono } from "hono";
 import { setCloudflareWorker } from "@gasoline-dev/resources";
 
 export const config = setCloudflareWorker({
+	type: "cloudflare-worker",
 	id: "core:base:cf-worker:api:v1:12345",
 	name: "",
 } as const);